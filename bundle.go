@@ -0,0 +1,177 @@
+package shigoto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DeedleFake/shigoto/internal/common"
+)
+
+// ErrNotContent is returned by ReadContent for files that aren't
+// content, such as images, which are instead resources of the content
+// that they're bundled with.
+var ErrNotContent = errors.New("not content")
+
+// isContentExt returns true if files at p are always content,
+// regardless of whether or not they have metadata.
+func isContentExt(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".md", ".markdown", ".html", ".htm":
+		return true
+	default:
+		return false
+	}
+}
+
+// A Resource is a file that is bundled with a piece of content and is
+// copied next to its output.
+type Resource struct {
+	// Name is the slash-separated path of the resource relative to
+	// the directory of the content that it belongs to.
+	Name string
+
+	// Path is the path of the resource's file relative to the publish
+	// directory, or to the draft directory if Draft is true.
+	Path  string
+	Draft bool
+
+	// Output is the path, relative to the output directory, that the
+	// resource is copied to, and URL is the root-relative URL of that
+	// path. Both are empty if the content's output paths can't be
+	// determined.
+	Output string
+	URL    string
+}
+
+// SourcePath returns the path to the resource's file relative to the
+// project root.
+func (r Resource) SourcePath() string {
+	return Content{Path: r.Path, Draft: r.Draft}.SourcePath()
+}
+
+// FindBundles groups the files in a directory into page bundles. Each
+// of assets belongs to the content in the nearest subdirectory that
+// contains it and that contains any content, provided that there is
+// exactly one piece of content there. The top level of the directory
+// is never a bundle, so content there has no assets. bundles maps the
+// paths of content to the paths of its assets, while orphans are the
+// assets that don't belong to anything.
+func FindBundles(content, assets []string) (bundles map[string][]string, orphans []string) {
+	dirs := make(map[string][]string)
+	for _, p := range content {
+		dirs[filepath.Dir(p)] = append(dirs[filepath.Dir(p)], p)
+	}
+
+	bundles = make(map[string][]string)
+	for _, asset := range assets {
+		dir := filepath.Dir(asset)
+		for {
+			if (dir == ".") || (dir == string(filepath.Separator)) {
+				orphans = append(orphans, asset)
+				break
+			}
+
+			if c := dirs[dir]; len(c) != 0 {
+				if len(c) == 1 {
+					bundles[c[0]] = append(bundles[c[0]], asset)
+				} else {
+					orphans = append(orphans, asset)
+				}
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	return bundles, orphans
+}
+
+// scanContent reads every file in dir, returning the content along
+// with the paths of the files that aren't content.
+func scanContent(dir string, draft bool) (content []Content, assets []string, err error) {
+	err = common.Walk(dir, func(p string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			return nil
+		}
+
+		c, err := ReadContent(dir, p, draft)
+		if err == ErrNotContent {
+			assets = append(assets, p)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		content = append(content, c)
+		return nil
+	})
+	return content, assets, err
+}
+
+// ReadResources returns the resources of the content file at path p
+// relative to dir, which should be either the publish or the draft
+// directory of a project. The Output and URL fields of the resources
+// are left empty.
+func ReadResources(dir, p string, draft bool) ([]Resource, error) {
+	var content, assets []string
+	err := common.Walk(dir, func(cur string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			return nil
+		}
+
+		_, err := ReadContent(dir, cur, draft)
+		if err == ErrNotContent {
+			assets = append(assets, cur)
+			return nil
+		}
+
+		content = append(content, cur)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %v", dir, err)
+	}
+
+	bundles, _ := FindBundles(content, assets)
+	return resources(p, bundles[p], draft), nil
+}
+
+// resources returns the resources for the assets bundled with the
+// content at p.
+func resources(p string, assets []string, draft bool) []Resource {
+	if len(assets) == 0 {
+		return nil
+	}
+
+	r := make([]Resource, 0, len(assets))
+	for _, asset := range assets {
+		name, _ := filepath.Rel(filepath.Dir(p), asset)
+		r = append(r, Resource{
+			Name:  filepath.ToSlash(name),
+			Path:  asset,
+			Draft: draft,
+		})
+	}
+
+	sort.Slice(r, func(i1, i2 int) bool {
+		return r[i1].Name < r[i2].Name
+	})
+
+	return r
+}
+
+// resourceURL returns the URL of the resource with the given name in
+// r.
+func resourceURL(name string, r []Resource) (string, error) {
+	for _, r := range r {
+		if r.Name == name {
+			return r.URL, nil
+		}
+	}
+	return "", fmt.Errorf("unknown resource %q", name)
+}
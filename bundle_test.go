@@ -0,0 +1,112 @@
+package shigoto
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindBundles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []string
+		assets  []string
+		bundles map[string][]string
+		orphans []string
+	}{
+		{
+			name:    "Bundle",
+			content: []string{"post/post.md", "other.md"},
+			assets:  []string{"post/cover.jpg", "post/img/1.png"},
+			bundles: map[string][]string{
+				"post/post.md": {"post/cover.jpg", "post/img/1.png"},
+			},
+		},
+		{
+			name:    "TopLevel",
+			content: []string{"solo.md"},
+			assets:  []string{"notes.txt", "imgs/unrelated.png"},
+			bundles: map[string][]string{},
+			orphans: []string{"notes.txt", "imgs/unrelated.png"},
+		},
+		{
+			name:    "Shared",
+			content: []string{"a/one.md", "a/two.md"},
+			assets:  []string{"a/img.png"},
+			bundles: map[string][]string{},
+			orphans: []string{"a/img.png"},
+		},
+		{
+			name:    "Nearest",
+			content: []string{"a/a.md", "a/b/b.md"},
+			assets:  []string{"a/b/c/img.png", "a/img.png"},
+			bundles: map[string][]string{
+				"a/a.md":   {"a/img.png"},
+				"a/b/b.md": {"a/b/c/img.png"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := make([]string, 0, len(test.content))
+			for _, p := range test.content {
+				content = append(content, filepath.FromSlash(p))
+			}
+			assets := make([]string, 0, len(test.assets))
+			for _, p := range test.assets {
+				assets = append(assets, filepath.FromSlash(p))
+			}
+
+			found, orphans := FindBundles(content, assets)
+
+			bundles := make(map[string][]string, len(found))
+			for c, a := range found {
+				for i := range a {
+					a[i] = filepath.ToSlash(a[i])
+				}
+				bundles[filepath.ToSlash(c)] = a
+			}
+			for i := range orphans {
+				orphans[i] = filepath.ToSlash(orphans[i])
+			}
+
+			if !reflect.DeepEqual(bundles, test.bundles) {
+				t.Errorf("bundles: expected %v, got %v", test.bundles, bundles)
+			}
+			if !reflect.DeepEqual(orphans, test.orphans) {
+				t.Errorf("orphans: expected %v, got %v", test.orphans, orphans)
+			}
+		})
+	}
+}
+
+func TestReadResourcesTopLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shigoto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{"solo.md", "notes.txt", filepath.Join("imgs", "unrelated.png")}
+	for _, p := range files {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(p)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, p), []byte("data\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := ReadResources(dir, "solo.md", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 0 {
+		t.Fatalf("expected no resources, got %v", r)
+	}
+}
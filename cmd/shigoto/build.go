@@ -3,18 +3,28 @@ package main
 import (
 	"flag"
 	"fmt"
+	htmltemplate "html/template"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
-	"text/template"
+	"sync"
 
 	"github.com/DeedleFake/shigoto"
 	"github.com/DeedleFake/shigoto/internal/common"
 )
 
 type buildCmd struct {
-	output string
+	output         string
+	force          bool
+	jobs           int
+	sitemap        string
+	allowOverwrite bool
+	checkLinks     bool
+	external       bool
+	content        contentFlags
 }
 
 func (cmd *buildCmd) Name() string {
@@ -30,11 +40,68 @@ func (cmd *buildCmd) Help() string {
 
 The build command converts the content files in the publish directory
 into static output files using the transformations specified in the
-tmpl directory.`
+tmpl directory. Content is rendered in parallel.
+
+Before anything is written, the output paths of every piece of content
+and every static file are checked for collisions. If two of them would
+produce the same file, the build fails unless -allow-overwrite is
+given, in which case the collisions are reported as warnings and the
+last of the sources in order of path, with content after static files
+and the files generated by -sitemap after both, wins. If any content
+fails to build, the rest is still built and all of the errors are
+reported together.
+
+Builds are incremental. The inputs that each piece of content's output
+depended on the last time that it was built, including the content
+file itself, the templates that it was rendered with, and any content
+that was queried during rendering, are recorded in a .shigoto-cache
+file in the project root. Content is only rendered again if one of
+those inputs has changed since or if its output is missing. Output
+belonging to content that no longer exists is removed.
+
+If -sitemap is given, a sitemap.xml listing the HTML output of every
+piece of content is written into the output directory along with a
+robots.txt that points to it. The last modification time of each page
+comes from the "updated" or "time" metadata of its content, and
+content can be left out of the sitemap by setting its "sitemap"
+metadata field, or that of its template, to false. Like any other
+output, these files are checked for collisions with content and static
+files and are removed once they are no longer generated. Sitemaps with
+more than 50,000 URLs are split into several files with sitemap.xml
+serving as an index of them.
+
+If -drafts is given, the files in the draft directory are built along
+with the published content as if they had been published, allowing
+them to be previewed. Their template data has Draft set to true, and
+they are left out of feeds and sitemaps.
+
+Content whose "time" metadata field is in the future is skipped unless
+-future is given, and content whose "expires" metadata field is in the
+past is skipped unless -expired is given. Both are compared against
+the current time, or against the time given with -now if there is
+one, which allows scheduled content to be published by rebuilding
+periodically.
+
+If -check-links is given, every HTML page in the output directory is
+checked once the build has finished for href and src attributes that
+point to files in the output directory that don't exist or to
+anchors, specified with id attributes or the name attributes of a
+tags, that don't exist in the pages that they point to. Every broken
+link is reported along with the source of the page that it's on and
+causes the build to fail. Root-relative links are resolved against the
+output directory. Links to other sites are not checked, but if
+-external is given as well then they are listed.`
 }
 
 func (cmd *buildCmd) Flags(fset *flag.FlagSet) {
 	fset.StringVar(&cmd.output, "o", "build", "output directory name relative to project root")
+	fset.BoolVar(&cmd.force, "force", false, "rebuild everything, even if it is up to date")
+	fset.IntVar(&cmd.jobs, "j", runtime.GOMAXPROCS(0), "number of pieces of content to render at once")
+	fset.StringVar(&cmd.sitemap, "sitemap", "", "if not empty, the base URL of the site to generate a sitemap for")
+	fset.BoolVar(&cmd.allowOverwrite, "allow-overwrite", false, "warn about colliding output paths instead of failing")
+	fset.BoolVar(&cmd.checkLinks, "check-links", false, "check the output for broken links")
+	fset.BoolVar(&cmd.external, "external", false, "list links to other sites when checking links")
+	cmd.content.register(fset)
 }
 
 func (cmd *buildCmd) Run(args []string) error {
@@ -43,163 +110,561 @@ func (cmd *buildCmd) Run(args []string) error {
 		return noRootErr
 	}
 
-	publish := filepath.Join(root, "publish")
-	output := filepath.Join(root, cmd.output)
+	b := &builder{
+		root:    root,
+		output:  filepath.Join(root, cmd.output),
+		force:   cmd.force,
+		jobs:    cmd.jobs,
+		sitemap: cmd.sitemap,
+		content: cmd.content,
+
+		allowOverwrite: cmd.allowOverwrite,
+		checkLinks:     cmd.checkLinks,
+		external:       cmd.external,
+	}
+	return b.build()
+}
+
+// A builder builds a project. A single builder can be used to build
+// the same project repeatedly, such as when watching it for changes.
+type builder struct {
+	root           string
+	output         string
+	force          bool
+	jobs           int
+	sitemap        string
+	allowOverwrite bool
+	checkLinks     bool
+	external       bool
+	content        contentFlags
+
+	cache  map[string]cacheEntry
+	owners map[string]outputSource
+}
+
+// contentFlags are the flags that control which content is built.
+type contentFlags struct {
+	drafts  bool
+	future  bool
+	expired bool
+	now     string
+}
+
+func (f *contentFlags) register(fset *flag.FlagSet) {
+	fset.BoolVar(&f.drafts, "drafts", false, "also build drafts")
+	fset.BoolVar(&f.future, "future", false, "build content with a time in the future")
+	fset.BoolVar(&f.expired, "expired", false, "build content that has expired")
+	fset.StringVar(&f.now, "now", "", "the time to check scheduled content against instead of the current time")
+}
+
+func (f contentFlags) apply(site *shigoto.Site) error {
+	site.Drafts = f.drafts
+	site.Future = f.future
+	site.Expired = f.expired
 
-	tmpl, err := shigoto.LoadTmpl(filepath.Join(root, "tmpl"))
+	if f.now != "" {
+		now, err := shigoto.ParseTime(f.now)
+		if err != nil {
+			return fmt.Errorf("invalid -now: %v", err)
+		}
+		site.Now = now
+	}
+
+	return nil
+}
+
+func (b *builder) build() error {
+	site, err := shigoto.LoadSite(b.root)
+	if err != nil {
+		return fmt.Errorf("failed to load site: %v", err)
+	}
+	err = b.content.apply(site)
 	if err != nil {
-		return fmt.Errorf("failed to load templates: %v", err)
+		return err
 	}
 
-	err = copyStatic(output, filepath.Join(root, "static"))
+	content, err := site.Content()
 	if err != nil {
 		return err
 	}
 
-	return common.Walk(publish, func(p string, fi os.FileInfo) error {
-		if fi.IsDir() {
-			return nil
+	static := filepath.Join(b.root, "static")
+	outputs := mapOutputs(site, content, static)
+
+	var sitemap []sitemapURL
+	var abs func(string) string
+	if b.sitemap != "" {
+		abs, err = shigoto.AbsURL(b.sitemap)
+		if err != nil {
+			return fmt.Errorf("invalid sitemap URL: %v", err)
+		}
+
+		sitemap = sitemapURLs(site, content, outputs, abs)
+		for _, p := range sitemapFiles(len(sitemap)) {
+			outputs[p] = append(outputs[p], sitemapSource)
+		}
+	}
+
+	if overwrites := collisions(outputs); len(overwrites) > 0 {
+		if !b.allowOverwrite {
+			return fmt.Errorf("output paths collide:\n\t%v", strings.Join(overwrites, "\n\t"))
 		}
 
-		in, err := os.Open(filepath.Join(publish, p))
+		for _, overwrite := range overwrites {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", overwrite)
+		}
+	}
+
+	// When overwriting is allowed, the last source of each path wins.
+	owners := make(map[string]outputSource, len(outputs))
+	for path, sources := range outputs {
+		owners[path] = sources[len(sources)-1]
+	}
+	b.owners = owners
+
+	err = copyStatic(b.output, static, func(p string) bool {
+		return owners[p] == outputSource{name: filepath.Join("static", p)}
+	})
+	if err != nil {
+		return err
+	}
+
+	// The old cache is still needed when forcing a rebuild so that the
+	// output of content that no longer exists can be removed.
+	if b.cache == nil {
+		b.cache, err = loadCache(b.root, b.output)
 		if err != nil {
-			return fmt.Errorf("failed to open %q: %v", p, err)
+			return err
 		}
-		defer in.Close()
+	}
+
+	in := newInputs(b.root, content)
+	entries := make([]cacheEntry, len(content))
+	errs := make([]error, len(content))
+	b.parallel(len(content), func(i int) {
+		entries[i], errs[i] = b.buildContent(site, in, content[i])
+	})
+
+	var buildErrs buildErrors
+	cache := make(map[string]cacheEntry, len(content))
+	for i, c := range content {
+		if errs[i] != nil {
+			buildErrs = append(buildErrs, errs[i])
 
-		meta := make(map[string]interface{})
-		inr, err := shigoto.ReadMeta(in, &meta)
+			// Keep the old output around, but make sure that it gets
+			// rebuilt next time.
+			if old, ok := b.cache[c.SourcePath()]; ok {
+				cache[c.SourcePath()] = cacheEntry{Files: old.Files}
+			}
+			continue
+		}
+
+		cache[c.SourcePath()] = entries[i]
+	}
+
+	if b.sitemap != "" {
+		err = writeSitemap(b.output, sitemap, abs)
 		if err != nil {
-			return fmt.Errorf("failed to load meta from %q: %v", p, err)
+			return err
 		}
+		cache[sitemapSource.name] = cacheEntry{Files: sitemapFiles(len(sitemap))}
+	}
+
+	err = removeStale(b.output, b.cache, cache, b.owners)
+	if err != nil {
+		return err
+	}
+
+	b.cache = cache
+	err = saveCache(b.root, b.output, cache)
+	if err != nil {
+		return err
+	}
 
-		var instr strings.Builder
-		_, err = io.Copy(&instr, inr)
+	if b.checkLinks {
+		linkErrs, err := b.links()
 		if err != nil {
-			return fmt.Errorf("failed to read %q: %v", p, err)
+			return err
+		}
+		buildErrs = append(buildErrs, linkErrs...)
+	}
+
+	if len(buildErrs) > 0 {
+		return buildErrs
+	}
+	return nil
+}
+
+// parallel calls f for every integer in [0, n) using at most b.jobs
+// goroutines at a time.
+func (b *builder) parallel(n int, f func(i int)) {
+	jobs := b.jobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				f(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// buildContent builds c if it has changed since the last build,
+// returning the cache entry that describes the result.
+func (b *builder) buildContent(site *shigoto.Site, in *inputs, c shigoto.Content) (cacheEntry, error) {
+	intmpl, err := site.ParseContent(c)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+
+	sources := make(map[string]string, len(c.Resources))
+	for _, r := range c.Resources {
+		sources[r.Output] = r.SourcePath()
+	}
+
+	owns := func(path string, page int) bool {
+		if page == 0 {
+			return b.owners[path] == outputSource{name: sources[path]}
+		}
+		return b.owners[path] == outputSource{name: c.SourcePath(), page: page}
+	}
+
+	deps := contentDeps(site, in, c, intmpl)
+	if old, ok := b.cache[c.SourcePath()]; ok && !b.force && old.upToDate(b.output, deps) && sameFiles(old.Files, ownedPaths(site, c, owns)) {
+		return old, nil
+	}
+
+	files, err := renderContent(site, b.output, c, intmpl, owns)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+
+	resources, err := copyResources(b.root, b.output, c, owns)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+	files = append(files, resources...)
+
+	return cacheEntry{
+		Deps:  deps,
+		Files: files,
+	}, nil
+}
+
+// ownedPaths returns the output paths of c that it is responsible for
+// writing.
+func ownedPaths(site *shigoto.Site, c shigoto.Content, owns func(path string, page int) bool) []string {
+	paths, _ := site.OutputPaths(c)
+
+	var owned []string
+	for i, path := range paths {
+		if owns(path, i+1) {
+			owned = append(owned, path)
 		}
+	}
+	for _, r := range c.Resources {
+		if (r.Output != "") && owns(r.Output, 0) {
+			owned = append(owned, r.Output)
+		}
+	}
+	return owned
+}
 
-		intmpl, err := template.New(p).Funcs(shigoto.StandardFuncs(tmpl)).Parse(instr.String())
+// copyResources copies the resources of c that it is responsible for
+// into output, returning their paths relative to output.
+func copyResources(root, output string, c shigoto.Content, owns func(path string, page int) bool) ([]string, error) {
+	var files []string
+	for _, r := range c.Resources {
+		if (r.Output == "") || !owns(r.Output, 0) {
+			continue
+		}
+
+		err := os.MkdirAll(filepath.Join(output, filepath.Dir(r.Output)), 0755)
 		if err != nil {
-			return fmt.Errorf("failed to parse %q: %v", p, err)
+			return nil, fmt.Errorf("failed to create directory for %q: %v", r.Output, err)
 		}
 
-		dtype, ok := meta["type"].(string)
-		if !ok {
-			return fmt.Errorf("no type in %q", p)
+		err = copyFile(filepath.Join(output, r.Output), filepath.Join(root, r.SourcePath()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy resource %q of %q: %v", r.Name, c.Path, err)
 		}
 
-		title, _ := meta["title"].(string)
+		files = append(files, r.Output)
+	}
+
+	return files, nil
+}
 
-		t, ok := tmpl[dtype]
-		if !ok {
-			return fmt.Errorf("unknown type %q in %q", dtype, p)
+func sameFiles(f1, f2 []string) bool {
+	if len(f1) != len(f2) {
+		return false
+	}
+	for i := range f1 {
+		if f1[i] != f2[i] {
+			return false
 		}
+	}
+	return true
+}
+
+// buildErrors is a list of errors from building several pieces of
+// content, sorted by the path of the content.
+type buildErrors []error
+
+func (errs buildErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v errors occurred:", len(errs))
+	for _, err := range errs {
+		sb.WriteString("\n\t")
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+// renderContent renders c into output, returning the paths, relative
+// to output, of the files that it wrote.
+func renderContent(site *shigoto.Site, output string, c shigoto.Content, intmpl shigoto.Tmpl, owns func(path string, page int) bool) ([]string, error) {
+	p := c.Path
 
-		pages, ok := tmplGet("pages", meta, t.Meta).(pagesInfo)
-		if !ok {
-			return fmt.Errorf("pages is not an object in %q", p)
+	if c.Type == "" {
+		return nil, fmt.Errorf("no type in %q", p)
+	}
+
+	t, ok := site.Tmpl[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q in %q", c.Type, p)
+	}
+
+	paths, err := site.OutputPaths(c)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, ok := shigoto.TmplGet("feed", c.Meta, t.Meta).(shigoto.FeedInfo)
+	if !ok {
+		return nil, fmt.Errorf("feed is not an object in %q", p)
+	}
+	if feed.Tmpl != "" {
+		if !owns(paths[0], 1) {
+			return nil, nil
 		}
+		return renderFeed(site, output, c, feed, paths[0])
+	}
 
-		numPages := 1
+	pages, numType, err := site.Pages(c)
+	if err != nil {
+		return nil, err
+	}
 
-		var numType int
-		if pages.Tmpl != "" {
-			num, err := shigoto.GetNumType(root, pages.Tmpl)
-			if err != nil {
-				return fmt.Errorf("failed to get number of pages for %q", pages.Tmpl)
-			}
-			numType = num
+	var files []string
+	for i, path := range paths {
+		currentPage := i + 1
+		if !owns(path, currentPage) {
+			continue
+		}
 
-			var extra int
-			if numType%pages.Per != 0 {
-				extra = 1
-			}
+		pageMap := pages.PageMap(currentPage, numType)
+
+		var content strings.Builder
+		err := intmpl.Tmpl.Execute(&content, map[string]interface{}{
+			"Type":      c.Type,
+			"Title":     c.Title,
+			"Tmpl":      t.Meta,
+			"Meta":      c.Meta,
+			"Draft":     c.Draft,
+			"Pages":     pageMap,
+			"Data":      site.Data,
+			"Resources": c.Resources,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute %q: %v", c.Type, err)
+		}
 
-			numPages = (numType / pages.Per) + extra
+		out, err := createOutput(output, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output for %q: %v", p, err)
 		}
 
-		for currentPage := 1; currentPage <= numPages; currentPage++ {
-			pageEnd := currentPage * pages.Per
-			if pageEnd > numType {
-				pageEnd = numType
-			}
+		err = executeInherit(site, c.Type, out, map[string]interface{}{
+			"Type":      c.Type,
+			"Title":     c.Title,
+			"Tmpl":      t.Meta,
+			"Meta":      c.Meta,
+			"Draft":     c.Draft,
+			"Content":   htmltemplate.HTML(content.String()),
+			"Pages":     pageMap,
+			"Data":      site.Data,
+			"Resources": c.Resources,
+		})
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+			return nil, fmt.Errorf("failed to execute %q: %v", p, err)
+		}
 
-			pageMap := map[string]interface{}{
-				"Last":      numPages,
-				"Current":   currentPage,
-				"PageStart": (currentPage - 1) * pages.Per,
-				"PageEnd":   pageEnd,
-			}
+		err = out.Close()
+		if err != nil {
+			os.Remove(out.Name())
+			return nil, fmt.Errorf("failed to write output for %q: %v", p, err)
+		}
 
-			var content strings.Builder
-			err = intmpl.Execute(&content, map[string]interface{}{
-				"Type":  dtype,
-				"Title": title,
-				"Tmpl":  t.Meta,
-				"Meta":  meta,
-				"Pages": pageMap,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to execute %q: %v", dtype, err)
-			}
+		files = append(files, path)
+	}
 
-			buildPath, ok := tmplGet("buildPath", meta, t.Meta).(string)
-			if !ok {
-				return fmt.Errorf("buildPath is not a string in %q", p)
-			}
+	return files, nil
+}
 
-			path, err := metaTmpl(buildPath, map[string]interface{}{
-				"Type":  dtype,
-				"Title": title,
-				"Tmpl":  t.Meta,
-				"Meta":  meta,
-				"Pages": pageMap,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to construct buildPath for %q: %v", p, err)
-			}
-			path = filepath.FromSlash(path)
+// renderFeed writes a feed for c into output at path instead of
+// rendering it normally.
+func renderFeed(site *shigoto.Site, output string, c shigoto.Content, feed shigoto.FeedInfo, path string) ([]string, error) {
+	out, err := createOutput(output, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output for %q: %v", c.Path, err)
+	}
 
-			err = os.MkdirAll(filepath.Join(output, filepath.Dir(path)), 0755)
-			if err != nil {
-				return fmt.Errorf("failed to create directory for %q: %v", p, err)
+	err = site.WriteFeed(out, c, feed)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return nil, fmt.Errorf("failed to write feed for %q: %v", c.Path, err)
+	}
+
+	return []string{path}, nil
+}
+
+// createOutput creates the file at path in output, along with any
+// necessary directories. If the file already exists, it is removed
+// first so that a hard link to a static file is never written
+// through.
+func createOutput(output, path string) (*os.File, error) {
+	path = filepath.Join(output, path)
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Remove(path)
+	if (err != nil) && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+}
+
+// outputSource identifies something that produces an output file:
+// either a page of a piece of content or, if page is zero, a static
+// file or a resource. The name is the path of the source relative to
+// the project root.
+type outputSource struct {
+	name string
+	page int
+}
+
+func (src outputSource) String() string {
+	if src.page > 1 {
+		return fmt.Sprintf("%q (page %v)", src.name, src.page)
+	}
+	return fmt.Sprintf("%q", src.name)
+}
+
+// mapOutputs maps the paths of output files to everything that
+// produces them, in the order in which they're written. Content whose
+// output paths can't be determined is skipped, as the problem will be
+// reported when it's rendered.
+func mapOutputs(site *shigoto.Site, content []shigoto.Content, static string) map[string][]outputSource {
+	outputs := make(map[string][]outputSource)
+
+	if _, err := os.Stat(static); err == nil {
+		_ = common.Walk(static, func(p string, fi os.FileInfo) error {
+			if !fi.IsDir() {
+				outputs[p] = append(outputs[p], outputSource{name: filepath.Join("static", p)})
 			}
+			return nil
+		})
+	}
 
-			out, err := os.OpenFile(
-				filepath.Join(output, path),
-				os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
-				0644,
-			)
-			if err != nil {
-				return fmt.Errorf("failed to create %q: %v", p, err)
+	for _, c := range content {
+		paths, err := site.OutputPaths(c)
+		if err != nil {
+			continue
+		}
+
+		for i, p := range paths {
+			outputs[p] = append(outputs[p], outputSource{name: c.SourcePath(), page: i + 1})
+		}
+		for _, r := range c.Resources {
+			if r.Output != "" {
+				outputs[r.Output] = append(outputs[r.Output], outputSource{name: r.SourcePath()})
 			}
-			defer out.Close()
-
-			err = executeInherit(tmpl, t, out, map[string]interface{}{
-				"Type":    dtype,
-				"Title":   title,
-				"Tmpl":    t.Meta,
-				"Meta":    meta,
-				"Content": content.String(),
-				"Pages":   pageMap,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to execute %q: %v", p, err)
+		}
+	}
+
+	return outputs
+}
+
+// collisions describes every pair of sources in outputs that produce
+// the same file, sorted by path.
+func collisions(outputs map[string][]outputSource) []string {
+	var paths []string
+	for path, sources := range outputs {
+		if len(sources) > 1 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var r []string
+	for _, path := range paths {
+		sources := outputs[path]
+		for i := range sources {
+			for j := i + 1; j < len(sources); j++ {
+				r = append(r, fmt.Sprintf("%v and %v both produce %q", sources[i], sources[j], path))
 			}
 		}
+	}
 
-		return nil
-	})
+	return r
 }
 
-func copyStatic(out, in string) error {
+func copyStatic(out, in string, include func(p string) bool) error {
 	_, err := os.Stat(in)
 	if err != nil {
 		return nil
 	}
 
 	return common.Walk(in, func(p string, fi os.FileInfo) error {
+		if !fi.IsDir() && !include(p) {
+			return nil
+		}
+
+		if fi.IsDir() {
+			err := os.MkdirAll(filepath.Join(out, p), 0755)
+			if err != nil {
+				return fmt.Errorf("failed to create directory %q: %v", p, err)
+			}
+			return nil
+		}
+
 		err := os.MkdirAll(filepath.Join(out, filepath.Dir(p)), 0755)
 		if err != nil {
 			return fmt.Errorf("failed to create directory for %q: %v", p, err)
@@ -211,6 +676,11 @@ func copyStatic(out, in string) error {
 		}
 
 		err = os.Link(filepath.Join(in, p), filepath.Join(out, p))
+		if err != nil {
+			// Hard links don't work across filesystems, such as into a
+			// temporary directory, so fall back to a regular copy.
+			err = copyFile(filepath.Join(out, p), filepath.Join(in, p))
+		}
 		if err != nil {
 			return fmt.Errorf("failed to copy %q: %v", p, err)
 		}
@@ -219,31 +689,72 @@ func copyStatic(out, in string) error {
 	})
 }
 
-func executeInherit(tmpl map[string]shigoto.Tmpl, t shigoto.Tmpl, out io.Writer, data map[string]interface{}) error {
-	inherit, ok := tmplGet("inherit", t.Meta).(string)
-	if !ok {
-		return t.Tmpl.Execute(out, data)
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	next, ok := tmpl[inherit]
-	if !ok {
-		return fmt.Errorf("unknown type %q", inherit)
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
 	}
+	defer out.Close()
 
-	var content strings.Builder
-	err := t.Tmpl.Execute(&content, data)
+	_, err = io.Copy(out, in)
 	if err != nil {
 		return err
 	}
 
-	nextData := make(map[string]interface{}, len(data))
-	for k, v := range data {
-		nextData[k] = v
+	return out.Close()
+}
+
+// executeInherit executes the named template with data, followed by
+// each of the templates that it inherits from, passing the output of
+// each to the next in the Content field. Errors are prefixed with the
+// chain of templates up to the one that failed.
+func executeInherit(site *shigoto.Site, name string, out io.Writer, data map[string]interface{}) error {
+	chain, err := site.Inherits(name)
+	if err != nil {
+		return err
 	}
-	for k, v := range next.Meta {
-		nextData["Tmpl"].(map[string]interface{})[k] = v
+
+	for i, name := range chain {
+		t := site.Tmpl[name]
+		if i == len(chain)-1 {
+			err := t.Tmpl.Execute(out, data)
+			if err != nil {
+				return fmt.Errorf("%v: %v", strings.Join(chain, " -> "), err)
+			}
+			return nil
+		}
+
+		var content strings.Builder
+		err := t.Tmpl.Execute(&content, data)
+		if err != nil {
+			return fmt.Errorf("%v: %v", strings.Join(chain[:i+1], " -> "), err)
+		}
+
+		// The template metadata is shared between concurrent executions,
+		// so it has to be copied rather than modified in place.
+		next := site.Tmpl[chain[i+1]]
+		nextTmpl := make(map[string]interface{})
+		for k, v := range data["Tmpl"].(map[string]interface{}) {
+			nextTmpl[k] = v
+		}
+		for k, v := range next.Meta {
+			nextTmpl[k] = v
+		}
+
+		nextData := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			nextData[k] = v
+		}
+		nextData["Tmpl"] = nextTmpl
+		nextData["Content"] = htmltemplate.HTML(content.String())
+		data = nextData
 	}
-	nextData["Content"] = content.String()
 
-	return executeInherit(tmpl, next, out, nextData)
+	return nil
 }
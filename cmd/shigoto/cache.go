@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DeedleFake/shigoto"
+)
+
+const cacheFile = ".shigoto-cache"
+
+// A cacheEntry records what a piece of content's output depended on
+// when it was last built.
+type cacheEntry struct {
+	// Deps maps the keys of inputs, as understood by inputs.hash, to
+	// their hashes.
+	Deps map[string]string `json:"deps"`
+
+	// Files are the paths of the output files relative to the output
+	// directory.
+	Files []string `json:"files"`
+}
+
+func (entry cacheEntry) upToDate(output string, deps map[string]string) bool {
+	if len(entry.Deps) != len(deps) {
+		return false
+	}
+	for k, v := range deps {
+		if entry.Deps[k] != v {
+			return false
+		}
+	}
+
+	for _, file := range entry.Files {
+		_, err := os.Stat(filepath.Join(output, file))
+		if err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cacheKey returns the key under which the cache for output is
+// stored, or false if the cache for output shouldn't be stored at
+// all, such as because it's a temporary directory.
+func cacheKey(root, output string) (string, bool) {
+	rel, err := filepath.Rel(root, output)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
+
+func readCacheFile(root string) (map[string]map[string]cacheEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(root, cacheFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache: %v", err)
+	}
+
+	var caches map[string]map[string]cacheEntry
+	err = json.Unmarshal(data, &caches)
+	if err != nil {
+		// A broken cache just means a full rebuild.
+		return nil, nil
+	}
+
+	return caches, nil
+}
+
+func loadCache(root, output string) (map[string]cacheEntry, error) {
+	key, ok := cacheKey(root, output)
+	if !ok {
+		return nil, nil
+	}
+
+	caches, err := readCacheFile(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return caches[key], nil
+}
+
+func saveCache(root, output string, cache map[string]cacheEntry) error {
+	key, ok := cacheKey(root, output)
+	if !ok {
+		return nil
+	}
+
+	caches, err := readCacheFile(root)
+	if err != nil {
+		return err
+	}
+	if caches == nil {
+		caches = make(map[string]map[string]cacheEntry)
+	}
+	caches[key] = cache
+
+	data, err := json.MarshalIndent(caches, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode cache: %v", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(root, cacheFile), data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+
+	return nil
+}
+
+// removeStale removes output files that were produced by the build
+// that prev describes but not by the one that cur does, such as those
+// of content that has been removed or of pages that no longer exist.
+// Files that are in owners, such as static files that have taken over
+// the paths of old output, are left alone.
+func removeStale(output string, prev, cur map[string]cacheEntry, owners map[string]outputSource) error {
+	used := make(map[string]bool, len(owners))
+	for file := range owners {
+		used[file] = true
+	}
+	for _, entry := range cur {
+		for _, file := range entry.Files {
+			used[file] = true
+		}
+	}
+
+	for p, entry := range prev {
+		for _, file := range entry.Files {
+			if used[file] {
+				continue
+			}
+
+			err := os.Remove(filepath.Join(output, file))
+			if (err != nil) && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove output of %q: %v", p, err)
+			}
+			removeEmptyDirs(output, filepath.Dir(file))
+		}
+	}
+
+	return nil
+}
+
+// removeEmptyDirs removes dir, relative to output, and each of its
+// parents below output for as long as they are empty.
+func removeEmptyDirs(output, dir string) {
+	for (dir != ".") && (dir != string(filepath.Separator)) {
+		if os.Remove(filepath.Join(output, dir)) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// inputs calculates and caches the hashes of the inputs to a build.
+// Keys are of the form
+//
+//   - "publish/<path>" and "draft/<path>": A content file or a
+//     resource.
+//   - "tmpl/<name>": A template file.
+//   - "data/<path>": A data file.
+//   - "type/<name>": All of the content of a type, as returned by
+//     getByType.
+//   - "tmpl/*", "data/*", and "type/*": Everything of that kind.
+type inputs struct {
+	root    string
+	content []shigoto.Content
+
+	m      sync.Mutex
+	hashes map[string]string
+}
+
+func newInputs(root string, content []shigoto.Content) *inputs {
+	return &inputs{
+		root:    root,
+		content: content,
+		hashes:  make(map[string]string),
+	}
+}
+
+func (in *inputs) hash(key string) string {
+	in.m.Lock()
+	h, ok := in.hashes[key]
+	in.m.Unlock()
+	if ok {
+		return h
+	}
+
+	sum := in.calculate(key)
+
+	in.m.Lock()
+	defer in.m.Unlock()
+	in.hashes[key] = sum
+	return sum
+}
+
+func (in *inputs) calculate(key string) string {
+	h := sha256.New()
+	switch {
+	case (key == "tmpl/*") || (key == "data/*"):
+		dir := strings.TrimSuffix(key, "/*")
+
+		var names []string
+		_ = filepath.Walk(filepath.Join(in.root, dir), func(p string, fi os.FileInfo, err error) error {
+			if (err == nil) && !fi.IsDir() {
+				rel, _ := filepath.Rel(filepath.Join(in.root, dir), p)
+				names = append(names, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(h, "%v %v\n", name, in.hash(dir+"/"+name))
+		}
+
+	case key == "type/*":
+		for _, c := range in.content {
+			fmt.Fprintf(h, "%v %v\n", c.SourcePath(), in.hash(filepath.ToSlash(c.SourcePath())))
+		}
+
+	case strings.HasPrefix(key, "type/"):
+		name := strings.TrimPrefix(key, "type/")
+		fmt.Fprintf(h, "%v\n", in.hash("tmpl/"+name))
+		for _, c := range in.content {
+			if c.Type == name {
+				fmt.Fprintf(h, "%v %v\n", c.SourcePath(), in.hash(filepath.ToSlash(c.SourcePath())))
+			}
+		}
+
+	default:
+		data, err := ioutil.ReadFile(filepath.Join(in.root, filepath.FromSlash(key)))
+		if err != nil {
+			// Missing files get an empty hash so that they still
+			// register as changed if they're created later.
+			return ""
+		}
+		h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// contentDeps determines the inputs that the output of c depends on,
+// returning them mapped to their current hashes.
+func contentDeps(site *shigoto.Site, in *inputs, c shigoto.Content, intmpl shigoto.Tmpl) map[string]string {
+	deps := make(map[string]string)
+	add := func(key string) {
+		deps[key] = in.hash(key)
+	}
+
+	add(filepath.ToSlash(c.SourcePath()))
+	for _, r := range c.Resources {
+		add(filepath.ToSlash(r.SourcePath()))
+	}
+
+	var visit func(tmpls, types []string)
+	visitTmpl := func(name string) {
+		key := "tmpl/" + filepath.ToSlash(name)
+		if _, ok := deps[key]; ok {
+			return
+		}
+		add(key)
+
+		if t, ok := site.Tmpl[name]; ok {
+			if t.UsesData() {
+				add("data/*")
+			}
+			visit(t.Calls())
+		}
+	}
+	visit = func(tmpls, types []string) {
+		for _, name := range tmpls {
+			visitTmpl(name)
+		}
+		for _, name := range types {
+			add("type/" + name)
+		}
+	}
+
+	if intmpl.UsesData() {
+		add("data/*")
+	}
+	visit(intmpl.Calls())
+
+	chain, err := site.Inherits(c.Type)
+	if err != nil {
+		chain = []string{c.Type}
+	}
+	for _, name := range chain {
+		visitTmpl(name)
+	}
+
+	if t, ok := site.Tmpl[c.Type]; ok {
+		if buildPath, ok := shigoto.TmplGet("buildPath", c.Meta, t.Meta).(string); ok && strings.Contains(buildPath, "Data") {
+			add("data/*")
+		}
+		if pages, ok := shigoto.TmplGet("pages", c.Meta, t.Meta).(shigoto.PagesInfo); ok && (pages.Tmpl != "") {
+			add("type/" + pages.Tmpl)
+		}
+		if feed, ok := shigoto.TmplGet("feed", c.Meta, t.Meta).(shigoto.FeedInfo); ok && (feed.Tmpl != "") {
+			add("type/" + feed.Tmpl)
+		}
+	}
+
+	return deps
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DeedleFake/shigoto"
+)
+
+// writeFiles writes files, which maps slash-separated paths to their
+// contents, into dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for p, data := range files {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "shigoto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestRemoveStale(t *testing.T) {
+	output, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFiles(t, output, map[string]string{
+		"a/index.html": "a",
+		"b/index.html": "b",
+		"b/img.png":    "b",
+		"c/index.html": "c",
+		"c/img.png":    "c",
+	})
+
+	prev := map[string]cacheEntry{
+		"publish/a.md":   {Files: []string{"a/index.html"}},
+		"publish/b.md":   {Files: []string{"b/index.html", "b/img.png"}},
+		"publish/c/c.md": {Files: []string{"c/index.html", "c/img.png"}},
+	}
+	cur := map[string]cacheEntry{
+		"publish/a.md": {Files: []string{"a/index.html"}},
+	}
+	owners := map[string]outputSource{
+		"a/index.html": {name: "publish/a.md", page: 1},
+		"b/index.html": {name: "static/b/index.html"},
+	}
+
+	err := removeStale(output, prev, cur, owners)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"a/index.html", "b/index.html"} {
+		if _, err := os.Stat(filepath.Join(output, p)); err != nil {
+			t.Errorf("%v was removed", p)
+		}
+	}
+	for _, p := range []string{"b/img.png", "c"} {
+		if _, err := os.Stat(filepath.Join(output, p)); !os.IsNotExist(err) {
+			t.Errorf("%v was not removed", p)
+		}
+	}
+}
+
+var depsProject = map[string]string{
+	"tmpl/base.html":  "<main>{{.Content}}</main>",
+	"tmpl/post.html":  "inherit: base.html\n+++++\n{{.Content}}",
+	"tmpl/list.html":  `{{range getByType "post.html"}}{{.Title}}{{end}}`,
+	"tmpl/data.html":  "{{.Data.site.name}}",
+	"data/site.yaml":  "name: Example\n",
+	"publish/a.md":    "type: post.html\ntitle: A\n+++++\nA",
+	"publish/list.md": "type: list.html\ntitle: List\n+++++\n",
+	"publish/d.md":    "type: data.html\ntitle: D\n+++++\n",
+}
+
+// loadDeps loads the project in root and returns the dependencies of
+// each piece of content in it.
+func loadDeps(t *testing.T, root string) map[string]map[string]string {
+	t.Helper()
+
+	site, err := shigoto.LoadSite(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := site.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := newInputs(root, content)
+	deps := make(map[string]map[string]string, len(content))
+	for _, c := range content {
+		intmpl, err := site.ParseContent(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deps[filepath.ToSlash(c.Path)] = contentDeps(site, in, c, intmpl)
+	}
+	return deps
+}
+
+func TestContentDeps(t *testing.T) {
+	root, cleanup := tempDir(t)
+	defer cleanup()
+	writeFiles(t, root, depsProject)
+
+	deps := loadDeps(t, root)
+
+	tests := []struct {
+		path    string
+		has     []string
+		hasNone []string
+	}{
+		{
+			path:    "a.md",
+			has:     []string{"publish/a.md", "tmpl/post.html", "tmpl/base.html"},
+			hasNone: []string{"data/*", "type/post.html", "tmpl/list.html"},
+		},
+		{
+			path:    "list.md",
+			has:     []string{"publish/list.md", "tmpl/list.html", "type/post.html"},
+			hasNone: []string{"data/*", "tmpl/post.html"},
+		},
+		{
+			path:    "d.md",
+			has:     []string{"publish/d.md", "tmpl/data.html", "data/*"},
+			hasNone: []string{"type/post.html", "tmpl/base.html"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			for _, key := range test.has {
+				if _, ok := deps[test.path][key]; !ok {
+					t.Errorf("missing %q in %v", key, deps[test.path])
+				}
+			}
+			for _, key := range test.hasNone {
+				if _, ok := deps[test.path][key]; ok {
+					t.Errorf("unexpected %q in %v", key, deps[test.path])
+				}
+			}
+		})
+	}
+}
+
+func TestContentDepsInvalidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		changed []string
+	}{
+		{
+			name:    "Tmpl",
+			files:   map[string]string{"tmpl/post.html": "inherit: base.html\n+++++\n<p>{{.Content}}</p>"},
+			changed: []string{"a.md", "list.md"},
+		},
+		{
+			name:    "InheritedTmpl",
+			files:   map[string]string{"tmpl/base.html": "<div>{{.Content}}</div>"},
+			changed: []string{"a.md"},
+		},
+		{
+			name:    "Data",
+			files:   map[string]string{"data/site.yaml": "name: Other\n"},
+			changed: []string{"d.md"},
+		},
+		{
+			name:    "NewData",
+			files:   map[string]string{"data/nav.yaml": "- home\n"},
+			changed: []string{"d.md"},
+		},
+		{
+			name:    "Type",
+			files:   map[string]string{"publish/b.md": "type: post.html\ntitle: B\n+++++\nB"},
+			changed: []string{"list.md"},
+		},
+		{
+			name:    "Content",
+			files:   map[string]string{"publish/a.md": "type: post.html\ntitle: A\n+++++\nChanged"},
+			changed: []string{"a.md", "list.md"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, cleanup := tempDir(t)
+			defer cleanup()
+			writeFiles(t, root, depsProject)
+
+			before := loadDeps(t, root)
+			writeFiles(t, root, test.files)
+			after := loadDeps(t, root)
+
+			changed := make(map[string]bool, len(test.changed))
+			for _, p := range test.changed {
+				changed[p] = true
+			}
+
+			for p, deps := range before {
+				old := cacheEntry{Deps: deps}
+				if upToDate := old.upToDate(root, after[p]); upToDate == changed[p] {
+					t.Errorf("%v: expected up to date to be %v", p, !changed[p])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+
+	"github.com/DeedleFake/shigoto"
+	"github.com/DeedleFake/shigoto/internal/common"
+)
+
+type checkCmd struct {
+	content contentFlags
+}
+
+func (cmd *checkCmd) Name() string {
+	return "check"
+}
+
+func (cmd *checkCmd) Desc() string {
+	return "checks the project for problems without building it"
+}
+
+func (cmd *checkCmd) Help() string {
+	return `Usage: check [flags]
+
+The check command loads every template, draft, and piece of published
+content in the project and reports every problem that it finds with
+them without writing any output. It checks for
+
+    - templates that can't be parsed,
+    - inherit fields that aren't strings, that refer to templates that
+      don't exist, or that form a cycle,
+    - sourceName and buildPath fields that aren't strings or aren't
+      valid templates,
+    - pages and feed fields that aren't objects, that refer to types
+      that don't exist, or that have invalid values,
+    - metadata and data files that can't be parsed,
+    - files that aren't content and that aren't in a page bundle,
+    - content with no type or with a type that doesn't exist,
+    - schema fields that can't be parsed and content whose metadata
+      doesn't match the schema of its type,
+    - content whose output paths can't be determined,
+    - time and expires fields that can't be parsed, and
+    - content, resources, and static files whose output paths
+      collide.
+
+The -drafts, -future, -expired, and -now flags work the same way as
+they do for the build command and affect which content is checked for
+collisions.
+
+If any problems are found, they are printed and the command exits
+with a non-zero status, making it suitable for use in pre-commit hooks
+and continuous integration.`
+}
+
+func (cmd *checkCmd) Flags(fset *flag.FlagSet) {
+	cmd.content.register(fset)
+}
+
+func (cmd *checkCmd) Run(args []string) error {
+	root, ok := shigoto.FindRoot(globalOptions.root)
+	if !ok {
+		return noRootErr
+	}
+
+	var problems []string
+	problem := func(source string, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%v: %v", source, fmt.Sprintf(format, args...)))
+	}
+
+	site, errs := shigoto.CheckSite(root)
+	for _, err := range errs {
+		if err, ok := err.(shigoto.DataError); ok {
+			problem(filepath.ToSlash(filepath.Join("data", err.Path)), "%v", err.Err)
+			continue
+		}
+		problem("tmpl", "%v", err)
+	}
+	err := cmd.content.apply(site)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(site.Tmpl))
+	for name := range site.Tmpl {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		source := filepath.ToSlash(filepath.Join("tmpl", name))
+		for _, p := range checkMeta(site, site.Tmpl[name].Meta) {
+			problem(source, "%v", p)
+		}
+	}
+
+	for _, dir := range []string{"draft", "publish"} {
+		draft := dir == "draft"
+		dir = filepath.Join(root, dir)
+
+		var paths, assets []string
+		err := common.Walk(dir, func(p string, fi os.FileInfo) error {
+			if fi.IsDir() {
+				return nil
+			}
+
+			source := filepath.ToSlash(shigoto.Content{Path: p, Draft: draft}.SourcePath())
+
+			c, err := shigoto.ReadContent(dir, p, draft)
+			if err == shigoto.ErrNotContent {
+				assets = append(assets, p)
+				return nil
+			}
+			paths = append(paths, p)
+			if err != nil {
+				problem(source, "%v", err)
+				return nil
+			}
+
+			for _, p := range checkTimes(c.Meta) {
+				problem(source, "%v", p)
+			}
+
+			_, err = site.ParseContent(c)
+			if err != nil {
+				problem(source, "%v", err)
+			}
+
+			if c.Type == "" {
+				problem(source, "no type")
+				return nil
+			}
+			t, ok := site.Tmpl[c.Type]
+			if !ok {
+				problem(source, "unknown type %q", c.Type)
+				return nil
+			}
+
+			for _, err := range site.ApplySchema(&c) {
+				problem(source, "%v", err)
+			}
+
+			metaProblems := checkMeta(site, c.Meta, t.Meta)
+			for _, p := range metaProblems {
+				problem(source, "%v", p)
+			}
+			if len(metaProblems) != 0 {
+				return nil
+			}
+
+			_, err = site.OutputPaths(c)
+			if err != nil {
+				problem(source, "%v", err)
+			}
+
+			return nil
+		})
+		if (err != nil) && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %q: %v", dir, err)
+		}
+
+		_, orphans := shigoto.FindBundles(paths, assets)
+		sort.Strings(orphans)
+		for _, p := range orphans {
+			problem(filepath.ToSlash(shigoto.Content{Path: p, Draft: draft}.SourcePath()), "not content and not in a page bundle")
+		}
+	}
+
+	content, err := site.Content()
+	if err == nil {
+		problems = append(problems, collisions(mapOutputs(site, content, filepath.Join(root, "static")))...)
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("found 1 problem")
+	default:
+		return fmt.Errorf("found %v problems", len(problems))
+	}
+}
+
+// checkMeta checks the special template fields that are set in meta,
+// falling back to the fields in fallback where necessary, and returns
+// descriptions of any problems with them.
+func checkMeta(site *shigoto.Site, meta map[string]interface{}, fallback ...map[string]interface{}) []string {
+	all := append([]map[string]interface{}{meta}, fallback...)
+	exists := func(name string) bool {
+		_, ok := site.Tmpl[name]
+		return ok
+	}
+
+	var problems []string
+	for _, field := range []string{"sourceName", "buildPath"} {
+		if _, ok := meta[field]; !ok {
+			continue
+		}
+
+		src, ok := shigoto.TmplGet(field, all...).(string)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%v is not a string", field))
+			continue
+		}
+
+		_, err := template.New(field).Funcs(shigoto.SiteFuncs(nil)).Parse(src)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid %v: %v", field, err))
+		}
+	}
+
+	if _, ok := meta["pages"]; ok {
+		pages, ok := shigoto.TmplGet("pages", all...).(shigoto.PagesInfo)
+		switch {
+		case !ok:
+			problems = append(problems, "pages is not an object")
+
+		case pages.Per <= 0:
+			problems = append(problems, fmt.Sprintf("pages has a non-positive per of %v", pages.Per))
+
+		case (pages.Tmpl != "") && !exists(pages.Tmpl):
+			problems = append(problems, fmt.Sprintf("pages refers to unknown type %q", pages.Tmpl))
+		}
+	}
+
+	if _, ok := meta["feed"]; ok {
+		feed, ok := shigoto.TmplGet("feed", all...).(shigoto.FeedInfo)
+		switch {
+		case !ok:
+			problems = append(problems, "feed is not an object")
+
+		case feed.Tmpl == "":
+
+		case !exists(feed.Tmpl):
+			problems = append(problems, fmt.Sprintf("feed refers to unknown type %q", feed.Tmpl))
+
+		case (feed.Format != "rss") && (feed.Format != "atom") && (feed.Format != "json"):
+			problems = append(problems, fmt.Sprintf("unknown feed format %q", feed.Format))
+		}
+	}
+
+	return problems
+}
+
+// checkTimes returns descriptions of any problems with the time and
+// expires fields in meta.
+func checkTimes(meta map[string]interface{}) []string {
+	var problems []string
+	for _, field := range []string{"time", "expires"} {
+		if v, ok := meta[field]; ok {
+			if _, err := shigoto.ParseTime(v); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid %v: %v", field, err))
+			}
+		}
+	}
+	return problems
+}
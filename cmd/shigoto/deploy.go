@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DeedleFake/shigoto"
+)
+
+type deployCmd struct {
+	branch  string
+	remote  string
+	message string
+	keep    string
+	content contentFlags
+}
+
+func (cmd *deployCmd) Name() string {
+	return "deploy"
+}
+
+func (cmd *deployCmd) Desc() string {
+	return "commits the output to a git branch"
+}
+
+func (cmd *deployCmd) Help() string {
+	return `Usage: deploy [flags]
+
+The deploy command builds the project into a temporary directory and
+commits the output onto a branch, gh-pages by default, of the git
+repository that contains the project. The working tree, the index, and
+the currently checked out branch are left alone. If -remote is given,
+the branch is then pushed to that remote.
+
+Files listed in -keep that exist on the branch but not in the output,
+such as a CNAME file set up by a hosting provider, are carried over
+from the previous commit on the branch.
+
+The -drafts, -future, -expired, and -now flags work the same way as
+they do for the build command.
+
+The commit message is a template. It is given the following data:
+
+    - Branch (string): The branch being deployed to.
+    - Source (string): The abbreviated hash of the currently checked
+      out commit, or an empty string if there isn't one.
+    - Time (time.Time): The time of the deployment.`
+}
+
+func (cmd *deployCmd) Flags(fset *flag.FlagSet) {
+	fset.StringVar(&cmd.branch, "branch", "gh-pages", "branch to commit the output to")
+	fset.StringVar(&cmd.remote, "remote", "", "if not empty, remote to push the branch to")
+	fset.StringVar(&cmd.message, "m", "Deploy{{with .Source}} from {{.}}{{end}}", "commit message template")
+	fset.StringVar(&cmd.keep, "keep", "CNAME,.nojekyll", "comma-separated files to carry over from the previous deployment")
+	cmd.content.register(fset)
+}
+
+func (cmd *deployCmd) Run(args []string) error {
+	root, ok := shigoto.FindRoot(globalOptions.root)
+	if !ok {
+		return noRootErr
+	}
+
+	gitDir, err := git(root, nil, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return fmt.Errorf("project is not in a git repository: %v", err)
+	}
+
+	output, err := ioutil.TempDir("", "shigoto")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(output)
+
+	b := &builder{
+		root:    root,
+		output:  output,
+		content: cmd.content,
+	}
+	err = b.build()
+	if err != nil {
+		return err
+	}
+
+	index, err := ioutil.TempFile("", "shigoto-index")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary index: %v", err)
+	}
+	index.Close()
+	os.Remove(index.Name())
+	defer os.Remove(index.Name())
+
+	env := []string{
+		"GIT_DIR=" + gitDir,
+		"GIT_WORK_TREE=" + output,
+		"GIT_INDEX_FILE=" + index.Name(),
+	}
+
+	ref := "refs/heads/" + cmd.branch
+	parent, _ := git(output, env, "rev-parse", "--verify", "-q", ref+"^{commit}")
+
+	_, err = git(output, env, "add", "--all", "--force", ".")
+	if err != nil {
+		return err
+	}
+
+	if parent != "" {
+		err = keepFiles(output, env, parent, strings.Split(cmd.keep, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	tree, err := git(output, env, "write-tree")
+	if err != nil {
+		return err
+	}
+
+	if parent != "" {
+		ptree, err := git(output, env, "rev-parse", parent+"^{tree}")
+		if err != nil {
+			return err
+		}
+		if ptree == tree {
+			fmt.Fprintf(os.Stderr, "No changes to deploy.\n")
+			return cmd.push(root)
+		}
+	}
+
+	source, _ := git(root, nil, "rev-parse", "--short", "HEAD")
+	msg, err := shigoto.MetaTmpl(cmd.message, map[string]interface{}{
+		"Branch": cmd.branch,
+		"Source": source,
+		"Time":   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to construct commit message: %v", err)
+	}
+
+	commitArgs := []string{"commit-tree", tree, "-m", msg}
+	if parent != "" {
+		commitArgs = append(commitArgs, "-p", parent)
+	}
+	commit, err := git(output, env, commitArgs...)
+	if err != nil {
+		return err
+	}
+
+	_, err = git(output, env, "update-ref", ref, commit, parent)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Deployed %v to %v.\n", commit, cmd.branch)
+
+	return cmd.push(root)
+}
+
+func (cmd *deployCmd) push(root string) error {
+	if cmd.remote == "" {
+		return nil
+	}
+
+	ref := "refs/heads/" + cmd.branch
+	_, err := git(root, nil, "push", cmd.remote, ref+":"+ref)
+	return err
+}
+
+// keepFiles adds any of files that are in the tree of parent but not
+// in output to the index.
+func keepFiles(output string, env []string, parent string, files []string) error {
+	for _, file := range files {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+
+		_, err := os.Lstat(filepath.Join(output, filepath.FromSlash(file)))
+		if err == nil {
+			continue
+		}
+
+		entry, err := git(output, env, "ls-tree", parent, "--", file)
+		if err != nil {
+			return err
+		}
+		if entry == "" {
+			continue
+		}
+
+		// ls-tree gives "<mode> <type> <hash>\t<path>".
+		fields := strings.Fields(entry)
+		if len(fields) < 3 || fields[1] != "blob" {
+			continue
+		}
+
+		_, err = git(output, env, "update-index", "--add", "--cacheinfo", fields[0]+","+fields[2]+","+file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// git runs a git command in dir with env added to the environment and
+// returns its trimmed output.
+func git(dir string, env []string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), env...)
+	c.Stderr = &stderr
+
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %v failed: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mustGit runs a git command in dir, failing the test if it fails.
+func mustGit(t *testing.T, dir string, env []string, args ...string) string {
+	t.Helper()
+
+	out, err := git(dir, env, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// repoState describes everything about the repository in dir that
+// deploying should leave alone.
+func repoState(t *testing.T, dir string) string {
+	t.Helper()
+
+	return strings.Join([]string{
+		mustGit(t, dir, nil, "symbolic-ref", "HEAD"),
+		mustGit(t, dir, nil, "rev-parse", "HEAD"),
+		mustGit(t, dir, nil, "ls-files", "--stage"),
+		mustGit(t, dir, nil, "status", "--porcelain", "--untracked-files=all"),
+	}, "\n")
+}
+
+// branchFiles returns the files in the tree of branch in the
+// repository in dir.
+func branchFiles(t *testing.T, dir, branch string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	for _, name := range strings.Split(mustGit(t, dir, nil, "ls-tree", "-r", "--name-only", branch), "\n") {
+		files[name] = mustGit(t, dir, nil, "show", branch+":"+name)
+	}
+	return files
+}
+
+func TestDeploy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	root := filepath.Join(dir, "site")
+	remote := filepath.Join(dir, "remote.git")
+
+	writeFiles(t, root, map[string]string{
+		"tmpl/page.html":   "<main>{{.Content}}</main>",
+		"publish/about.md": "type: page.html\ntitle: About\n+++++\nAbout",
+		"draft/draft.md":   "type: page.html\ntitle: Draft\n+++++\nDraft",
+	})
+	mustGit(t, dir, nil, "init", "-q", "--bare", remote)
+	mustGit(t, dir, nil, "init", "-q", root)
+	mustGit(t, root, nil, "config", "user.name", "Test")
+	mustGit(t, root, nil, "config", "user.email", "test@example.com")
+	mustGit(t, root, nil, "remote", "add", "origin", remote)
+	mustGit(t, root, nil, "add", "tmpl", "publish")
+	mustGit(t, root, nil, "commit", "-q", "-m", "Initial commit")
+
+	// Leave the working tree and the index dirty.
+	writeFiles(t, root, map[string]string{
+		"publish/staged.md": "type: page.html\ntitle: Staged\n+++++\nStaged",
+	})
+	mustGit(t, root, nil, "add", "publish/staged.md")
+
+	globalOptions.root = root
+	defer func() { globalOptions.root = "" }()
+	deploy := func() {
+		t.Helper()
+
+		cmd := &deployCmd{
+			branch:  "gh-pages",
+			remote:  "origin",
+			message: "Deploy{{with .Source}} from {{.}}{{end}}",
+			keep:    "CNAME,.nojekyll",
+		}
+
+		before := repoState(t, root)
+		err := cmd.Run(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after := repoState(t, root); after != before {
+			t.Fatalf("repository changed:\n%v\n\nbecame\n\n%v", before, after)
+		}
+		if l, r := mustGit(t, root, nil, "rev-parse", "gh-pages"), mustGit(t, remote, nil, "rev-parse", "gh-pages"); l != r {
+			t.Fatalf("remote is at %v instead of %v", r, l)
+		}
+	}
+
+	deploy()
+	files := branchFiles(t, root, "gh-pages")
+	if len(files) != 2 || files["about/index.html"] != "<main>About</main>" || files["staged/index.html"] != "<main>Staged</main>" {
+		t.Fatalf("unexpected files on branch: %v", files)
+	}
+	source := mustGit(t, root, nil, "rev-parse", "--short", "HEAD")
+	if msg := mustGit(t, root, nil, "log", "-1", "--format=%s", "gh-pages"); msg != "Deploy from "+source {
+		t.Errorf("unexpected commit message %q", msg)
+	}
+
+	// Add files to the branch the way that a hosting provider would.
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+	mustGit(t, root, env, "read-tree", "gh-pages")
+	for _, file := range []string{"CNAME", ".nojekyll", "old.html"} {
+		writeFiles(t, dir, map[string]string{file: file + "\n"})
+		hash := mustGit(t, root, nil, "hash-object", "-w", filepath.Join(dir, file))
+		mustGit(t, root, env, "update-index", "--add", "--cacheinfo", "100644,"+hash+","+file)
+	}
+	tree := mustGit(t, root, env, "write-tree")
+	commit := mustGit(t, root, nil, "commit-tree", tree, "-p", "gh-pages", "-m", "Add CNAME")
+	mustGit(t, root, nil, "update-ref", "refs/heads/gh-pages", commit)
+
+	writeFiles(t, root, map[string]string{
+		"publish/about.md": "type: page.html\ntitle: About\n+++++\nChanged",
+	})
+
+	deploy()
+	files = branchFiles(t, root, "gh-pages")
+	if files["about/index.html"] != "<main>Changed</main>" {
+		t.Errorf("output was not updated: %v", files)
+	}
+	if files["CNAME"] != "CNAME" || files[".nojekyll"] != ".nojekyll" {
+		t.Errorf("kept files were not carried over: %v", files)
+	}
+	if _, ok := files["old.html"]; ok {
+		t.Errorf("old output was carried over: %v", files)
+	}
+	if parent := mustGit(t, root, nil, "rev-parse", "gh-pages^"); parent != commit {
+		t.Errorf("expected parent %v, got %v", commit, parent)
+	}
+
+	head := mustGit(t, root, nil, "rev-parse", "gh-pages")
+	deploy()
+	if after := mustGit(t, root, nil, "rev-parse", "gh-pages"); after != head {
+		t.Errorf("deploying without changes committed %v", after)
+	}
+}
@@ -21,9 +21,10 @@
 //
 // The draft directory stores drafts of content. These will be skipped
 // when building a site, but can be published using the "publish"
-// command. All files in this directory, regardless of their location
-// in subdirectories, are treated the same as if they were in the
-// top-level of the directory.
+// command. Published content can be moved back into this directory
+// using the "unpublish" command. All files in this directory,
+// regardless of their location in subdirectories, are treated the
+// same as if they were in the top-level of the directory.
 //
 // The publish directory stores published content. These will be
 // converted into output when the "build" command is run using the
@@ -31,11 +32,42 @@
 // regardless of their location in subdirectories, are treated the
 // same as if they were in the top-level of the directory.
 //
+// Not every file in the draft and publish directories has to be
+// content. Files with an md, markdown, html, or htm extension are
+// always content, but other files are only content if they have
+// metadata with a type. The rest, such as images, are resources,
+// which belong to the content in the nearest directory above them
+// that contains exactly one piece of content, forming a page bundle.
+// For example, publish/post/cover.jpg and publish/post/img/1.png both
+// belong to publish/post/post.md if that is the only content in
+// publish/post. The top level of the draft and publish directories is
+// never a page bundle, so content that should have resources must be
+// in a subdirectory. When content is built, its resources are copied
+// into the directory of the output of its first page, keeping their
+// paths relative to the content, and they are moved along with the
+// content by the "publish" and "unpublish" commands. A resource that
+// doesn't belong to any content, such as because it's next to more
+// than one piece of content or because it's at the top level, is an
+// error.
+//
 // Along with these, an option static directory may be included in the
 // project root. If this directory exists, any files in it will be
 // copied into the output directory verbatim before the actual build
 // begins.
 //
+// An optional data directory may also be included in the project
+// root. Every YAML, JSON, TOML, and CSV file in it, identified by a
+// yaml or yml, json, toml, or csv extension, respectively, is loaded
+// and made available to every template in the Data field of the data
+// passed to it. The files are keyed by their paths without their
+// extensions, so the contents of data/nav/main.yaml are available as
+// .Data.nav.main. The first row of a CSV file names its columns, and
+// the file is loaded as a list with an object for each of its other
+// rows. Other files in the directory are ignored, and a file may not
+// have the same path as another file or a directory once their
+// extensions are removed. Content is rebuilt when the data changes if
+// its templates refer to Data.
+//
 // File Structure
 //
 // All files follow a similar structure to each other. Each begins
@@ -46,6 +78,21 @@
 // anywhere in the file, it is assumed that the file has no metadata
 // and the entire file is considered to be content.
 //
+// Metadata can also be specified as TOML or as JSON. If the first
+// line of a file contains exactly three plus signs, the metadata is
+// TOML and ends at the next such line, without a separator line. If a
+// file begins with a JSON object that is immediately followed by a
+// separator line, that object is the metadata. The separator line is
+// required so that a file whose content is itself JSON, such as a
+// template for a JSON file, is never mistaken for one with metadata.
+// Regardless of the format, the metadata has the same structure when
+// it is used in templates. Commands that change metadata, such as
+// "publish", only add or remove the fields that they need to, leaving
+// the order of the rest of the fields, comments, and formatting
+// exactly as they were. If that isn't possible, such as for YAML
+// metadata that is written as a flow mapping, they fail without
+// changing anything.
+//
 // A file may contain any metadata that it wants to. The data
 // specified is available inside the templates that are used to render
 // the file. Some files, however, have several special metadata fields
@@ -60,7 +107,9 @@
 //      from that template execution is used as the output of the
 //      entire execution. This allows a project to have a global
 //      template that provides the basic structure for the site with
-//      individual templates that handle specifics.
+//      individual templates that handle specifics. Inheriting from a
+//      template that doesn't exist or in a way that forms a cycle is
+//      an error.
 //
 //    - sourceName (string): This field specifies the format to use
 //      for creating draft filenames using this template. The contents
@@ -81,6 +130,58 @@
 //      you want to create pages that list those with five per page,
 //      use "{tmpl: post.html, per: 5}".
 //
+//    - feed ({tmpl: string, limit: int, format: string}): This field
+//      indicates that content using the current template is a feed
+//      of another template type rather than a normal page. If tmpl is
+//      not blank, the template itself is not executed. Instead, a
+//      feed of the most recent content of type tmpl, at most limit
+//      items of it, is written to the content's buildPath. Items are
+//      ordered by their "time" metadata and their bodies are the
+//      output of their own templates, but not of any templates that
+//      those inherit from. The format field may be "atom", "rss", or
+//      "json", for Atom 1.0, RSS 2.0, and JSON Feed 1.1,
+//      respectively. The default is "{limit: 20, format: atom}". The
+//      feed's title comes from the title of the content, while its
+//      description and author come from its "description" and
+//      "author" metadata fields, if it has them. Items' authors and
+//      summaries come from their own "author" and "summary" fields,
+//      and an "updated" field may be used to indicate when an item was
+//      last modified.
+//
+//    - baseURL (string): The absolute URL that the site is located
+//      at, such as "https://example.com/". This is necessary for
+//      anything that requires absolute URLs, such as feeds.
+//
+//    - sitemap (bool): If this is false, content using the template
+//      is left out of the sitemap generated by "build -sitemap".
+//
+//    - schema (object): This field describes the metadata that
+//      content using the template is expected to have. Each key is
+//      the name of a metadata field, and its value is either the name
+//      of a type or an object of the form {type: string, required:
+//      bool, enum: list, default: any}. The type may be "string",
+//      "int", "float", "bool", "time", "list", or "object", or may be
+//      left out to allow any type. If required is true, content
+//      without the field is an error. If enum is given, the field's
+//      value, or every element of it for a list, must be one of the
+//      values in it. If default is given, content without the field
+//      is treated as though it had the default value, including in
+//      the Meta field of template data. Content that doesn't match
+//      its type's schema is reported by the build and check
+//      commands. For example,
+//
+//          schema:
+//            author: {type: string, required: true}
+//            category: {enum: [news, tech], default: news}
+//            tags: list
+//
+//    - html (bool): This field specifies whether the template is
+//      parsed using Go's html/template package, which escapes data
+//      according to the context in which it is inserted, or using
+//      text/template, which doesn't escape anything. The default is
+//      true for templates with an html or htm extension and false for
+//      everything else.
+//
 // In drafts, the following fields have an effect:
 //
 //    - type (string): This field specifies the template type of the
@@ -91,9 +192,25 @@
 //      used in a number of places, including the creation of file
 //      names.
 //
+//    - html (bool): The bodies of content files are also executed as
+//      templates. They're parsed using html/template if their type's
+//      template is, so that data inserted into them is escaped before
+//      it ends up in the type's HTML output, and using text/template
+//      otherwise. If this field is true, html/template is used
+//      regardless of the type.
+//
+//    - time (time): This field is set to the time of publication by
+//      the publish command, but it can also be set by hand. If it is
+//      in the future, the content is skipped when building unless the
+//      -future flag is given.
+//
+//    - expires (time): If this field is set and is in the past, the
+//      content is skipped when building unless the -expired flag is
+//      given.
+//
 // Along with these, any of the fields specified above for templateu
 // files can be overriden inside of draft files with the exception of
-// "inherit".
+// "inherit" and "schema".
 //
 // Template Execution
 //
@@ -115,6 +232,23 @@
 //    - Meta (map): The metadata of the content involved in this
 //      execution.
 //
+//    - Content (HTML): The output of the previous stage of
+//      execution, meaning the content's body for the content's own
+//      template and the output of a template for the template that it
+//      inherits from. It is not escaped by html/template.
+//
+//    - Draft (bool): True if the content involved is a draft that is
+//      being built because of the -drafts flag.
+//
+//    - Data (map): The data loaded from the data directory.
+//
+//    - Resources ([]Resource): The resources of the content involved,
+//      sorted by name. Each has the following fields:
+//          - Name (string): The path of the resource relative to the
+//            directory of the content, such as "img/1.png".
+//          - URL (string): The root-relative URL of the resource's
+//            output.
+//
 //    - Pages (map): Contains page creation information. Keys are
 //          - "Last": Number of the last. Same thing as the total
 //            number of pages.
@@ -124,8 +258,10 @@
 //
 // Along with these, several functions are available:
 //
-//    - markdown (string -> string): Runs its input through a Markdown
-//      engine and returns the output.
+//    - markdown (string | HTML -> HTML): Runs its input through a
+//      Markdown engine and returns the output. The output is not
+//      escaped by html/template. Anything else, including a missing
+//      field, is an error.
 //
 //    - slug (string -> string): Converts a string into a slug to make
 //      it more suitable for a URL or filename.
@@ -145,6 +281,69 @@
 //    - ext (string -> string): Returns the extension of a filename
 //      without the intervening dot.
 //
-//    - tmpl (string, any -> string): Finds and executes the specified
-//      template from the tmpl directory using the given data.
+//    - tmpl (string, any -> string | HTML): Finds and executes the
+//      specified template from the tmpl directory using the given
+//      data. If that template uses html/template, the output is HTML
+//      and is thus not escaped again.
+//
+//    - getByType (string -> []Content): Returns all of the published
+//      content with the given type, sorted by the path of the files
+//      in the publish directory. If drafts are being built, they are
+//      included as well. Each piece of content has the fields
+//          - Path (string): The path of the content's file relative to
+//            the publish directory, or to the draft directory for
+//            drafts.
+//          - Type (string): The content's type.
+//          - Title (string): The content's title.
+//          - Meta (map): The content's metadata.
+//          - Body (string): The unrendered content of the file.
+//          - URL (string): The root-relative URL of the content's
+//            output, or of its first page if it has more than one. A
+//            trailing index.html is removed.
+//          - Time (time.Time): The time from the content's "time"
+//            metadata field, or the zero time if it doesn't have one.
+//          - Expires (time.Time): The time from the content's
+//            "expires" metadata field, or the zero time if it doesn't
+//            have one.
+//          - Draft (bool): True if the content is a draft.
+//          - Resources ([]Resource): The content's resources.
+//
+//    - filter (string, string, any, []Content -> []Content): Returns
+//      the content whose value for the key given as the first
+//      argument passes the check given as the second argument against
+//      the value given as the third. The key may be the name of one of
+//      the fields of Content, such as Title or Time, or the name of a
+//      metadata field. Numbers and times are compared as such. The
+//      available checks are
+//          - "eq" and "ne": The value is or isn't equal to the given
+//            value.
+//          - "lt" and "gt": The value is less than or greater than the
+//            given value.
+//          - "in": The value is in the given list. A string is treated
+//            as a comma-separated list.
+//          - "contains": The value is a list that contains the given
+//            value or a string that contains it as a substring.
+//          - "exists": The content has the key at all. The given value
+//            is ignored.
+//      For example, {{getByType "post.html" | filter "author" "eq" "me"}}.
+//
+//    - sort (string, string, []Content -> []Content): Sorts content
+//      by the key given as the first argument, either "asc" or "desc"
+//      depending on the second. Keys are the same as for filter.
+//      Content without the key is placed last. The sort is stable, so
+//      content with equal values remains sorted by path.
+//
+//    - slice (int, int, []Content -> []Content): Returns the content
+//      from the first index up to but not including the second.
+//      Indices before the start or past the end of the content are
+//      clamped to it. Note that this replaces the built-in slice
+//      function of text/template.
+//
+//    - pageSlice (map, []Content -> []Content): Returns the content
+//      on the page described by the given Pages map. For example,
+//      {{getByType "post.html" | sort "Time" "desc" | pageSlice .Pages}}.
+//
+//    - resource (string, []Resource -> string): Returns the URL of
+//      the resource with the given name. For example,
+//      <img src="{{resource "cover.jpg" .Resources}}">.
 package main
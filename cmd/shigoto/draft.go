@@ -23,12 +23,17 @@ func (cmd *draftCmd) Desc() string {
 
 func (cmd *draftCmd) Help() string {
 	return `Usage: draft <type> [title]
+       draft <draft>
 
 The draft command creates a new draft of the given type and prints the
 path to it to stdout. If a file already exists at the path that the
 new draft would be created at, the path to that file is printed but no
 other action is taken.
 
+If the only argument is not the name of a type, it is instead used to
+find an existing draft in the same way as the publish command, and the
+path to that draft is printed.
+
 For example, if you want to edit, using vim, a draft of type page.html
 with the title "This is an Example", regardless of whether it exists
 or not, simply run
@@ -64,22 +69,31 @@ func (cmd *draftCmd) Run(args []string) error {
 		return noRootErr
 	}
 
-	tmpl, err := shigoto.LoadTmpl(root)
+	site, err := shigoto.LoadSite(root)
 	if err != nil {
 		return err
 	}
 
-	t, ok := tmpl[dtype]
+	t, ok := site.Tmpl[dtype]
 	if !ok {
-		return fmt.Errorf("unknown type %q", dtype)
+		if len(args) > 1 {
+			return fmt.Errorf("unknown type %q", dtype)
+		}
+
+		name, err := locate(root, "draft", args[0])
+		if err != nil {
+			return fmt.Errorf("unknown type %q and no matching draft: %v", dtype, err)
+		}
+		fmt.Println(filepath.Join(root, "draft", name))
+		return nil
 	}
 
-	sourceName, ok := tmplGet("sourceName", t.Meta).(string)
+	sourceName, ok := shigoto.TmplGet("sourceName", t.Meta).(string)
 	if !ok {
 		return errors.New("sourceName is not a string")
 	}
 
-	name, err := metaTmpl(sourceName, map[string]interface{}{
+	name, err := shigoto.MetaTmpl(sourceName, map[string]interface{}{
 		"Type":  dtype,
 		"Title": title,
 		"Tmpl":  t.Meta,
@@ -88,6 +102,11 @@ func (cmd *draftCmd) Run(args []string) error {
 		return err
 	}
 
+	name, err = shigoto.CleanPath(name)
+	if err != nil {
+		return fmt.Errorf("invalid sourceName for %q: %v", title, err)
+	}
+
 	path := filepath.Join(root, "draft", name)
 
 	_, err = os.Stat(path)
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/DeedleFake/shigoto/internal/common"
+)
+
+var (
+	rawTextRE = regexp.MustCompile(`(?is)(<(script|style)\b[^>]*>).*?(</(script|style)\s*>)`)
+	tagRE     = regexp.MustCompile(`(?s)<!--.*?-->|<([a-zA-Z][a-zA-Z0-9-]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'>]+))?)*)\s*/?>`)
+	attrRE    = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+)
+
+// htmlLink is a link found in an HTML page.
+type htmlLink struct {
+	attr string
+	val  string
+}
+
+// scanHTML finds every link in the href and src attributes of the
+// tags in an HTML page, along with every anchor that the page defines
+// using id attributes or the name attributes of a tags.
+func scanHTML(page string) (links []htmlLink, anchors map[string]bool) {
+	anchors = make(map[string]bool)
+
+	page = rawTextRE.ReplaceAllString(page, "$1$3")
+	for _, tag := range tagRE.FindAllStringSubmatch(page, -1) {
+		if tag[1] == "" {
+			continue
+		}
+		name := strings.ToLower(tag[1])
+
+		for _, attr := range attrRE.FindAllStringSubmatch(tag[2], -1) {
+			key := strings.ToLower(attr[1])
+			val := html.UnescapeString(attr[2] + attr[3] + attr[4])
+
+			switch {
+			case (key == "href") || (key == "src"):
+				links = append(links, htmlLink{attr: key, val: strings.TrimSpace(val)})
+			case key == "id", (key == "name") && (name == "a"):
+				anchors[val] = true
+			}
+		}
+	}
+
+	return links, anchors
+}
+
+// isHTMLFile returns true if p is the path of an HTML page.
+func isHTMLFile(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".html", ".htm":
+		return true
+	default:
+		return false
+	}
+}
+
+// links checks every link in the HTML pages in the output directory
+// that points to another file in that directory, returning an error
+// for each link to a file or an anchor that doesn't exist. Links to
+// other sites are skipped, but are printed if b.external is true.
+func (b *builder) links() ([]error, error) {
+	pages := make(map[string][]htmlLink)
+	anchors := make(map[string]map[string]bool)
+	err := common.Walk(b.output, func(p string, fi os.FileInfo) error {
+		if fi.IsDir() || !isHTMLFile(p) {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(b.output, p))
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %v", p, err)
+		}
+
+		p = filepath.ToSlash(p)
+		pages[p], anchors[p] = scanHTML(string(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(pages))
+	for p := range pages {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var errs []error
+	for _, p := range paths {
+		source := fmt.Sprintf("%q", p)
+		if owner, ok := b.owners[filepath.FromSlash(p)]; ok {
+			source = fmt.Sprintf("%v (%q)", owner, p)
+		}
+
+		for _, link := range pages[p] {
+			u, err := url.Parse(link.val)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v: invalid %v %q: %v", source, link.attr, link.val, err))
+				continue
+			}
+
+			if (u.Scheme != "") || (u.Host != "") || strings.HasPrefix(link.val, "//") {
+				if b.external && ((u.Scheme == "") || (u.Scheme == "http") || (u.Scheme == "https")) {
+					fmt.Printf("%v: external link to %q\n", source, link.val)
+				}
+				continue
+			}
+
+			target, ok := resolveLink(b.output, p, u.Path)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%v: link to missing file %q", source, link.val))
+				continue
+			}
+
+			if (u.Fragment == "") || (u.Fragment == "top") || !isHTMLFile(target) {
+				continue
+			}
+			if !anchors[target][u.Fragment] {
+				errs = append(errs, fmt.Errorf("%v: link to missing anchor %q", source, link.val))
+			}
+		}
+	}
+
+	return errs, nil
+}
+
+// resolveLink resolves the path of a link in the page at from, both
+// of which are relative to output, to the file in output that it
+// refers to. It returns false if the file doesn't exist.
+func resolveLink(output, from, link string) (string, bool) {
+	if link == "" {
+		return from, true
+	}
+
+	target := link
+	if !strings.HasPrefix(link, "/") {
+		target = path.Join(path.Dir(from), link)
+	}
+	target = strings.TrimPrefix(path.Clean("/"+target), "/")
+
+	fi, err := os.Stat(filepath.Join(output, filepath.FromSlash(target)))
+	if err != nil {
+		return "", false
+	}
+	if !fi.IsDir() {
+		return target, true
+	}
+
+	for _, index := range []string{"index.html", "index.htm"} {
+		index = path.Join(target, index)
+		if _, err := os.Stat(filepath.Join(output, filepath.FromSlash(index))); err == nil {
+			return index, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DeedleFake/shigoto"
+	"github.com/DeedleFake/shigoto/internal/common"
+)
+
+type listCmd struct {
+	dtype string
+	state string
+	json  bool
+}
+
+func (cmd *listCmd) Name() string {
+	return "list"
+}
+
+func (cmd *listCmd) Desc() string {
+	return "lists drafts and published content"
+}
+
+func (cmd *listCmd) Help() string {
+	return `Usage: list [flags]
+
+The list command prints a table of every draft and every piece of
+published content in the project, along with its type, title, time,
+the path of its file relative to the project root, and the path of its
+output relative to the output directory. If the content produces more
+than one page of output, only the first is shown along with the number
+of others.
+
+The state of each file is one of
+
+    - draft: The file is in the draft directory.
+    - published: The file is in the publish directory and is built.
+    - scheduled: The file is in the publish directory but its time is
+      in the future, so it isn't built yet.
+    - expired: The file is in the publish directory but it has
+      expired, so it is no longer built.
+
+Files with metadata that can't be read, that have no type or a type
+with no template, or whose output paths can't be determined are
+reported on stderr after the table, but are still listed.
+
+If -json is given, a JSON array of objects is printed instead of the
+table, with the problems found with each file listed in the objects
+rather than on stderr.`
+}
+
+func (cmd *listCmd) Flags(fset *flag.FlagSet) {
+	fset.StringVar(&cmd.dtype, "type", "", "only list content of this type")
+	fset.StringVar(&cmd.state, "state", "", "only list content in this state")
+	fset.BoolVar(&cmd.json, "json", false, "print JSON instead of a table")
+}
+
+// listEntry is a single file printed by the list command.
+type listEntry struct {
+	State    string   `json:"state"`
+	Type     string   `json:"type"`
+	Title    string   `json:"title"`
+	Time     string   `json:"time,omitempty"`
+	Source   string   `json:"source"`
+	Output   []string `json:"output"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+func (cmd *listCmd) Run(args []string) error {
+	switch cmd.state {
+	case "", "draft", "published", "scheduled", "expired":
+	default:
+		return fmt.Errorf("unknown state %q", cmd.state)
+	}
+
+	root, ok := shigoto.FindRoot(globalOptions.root)
+	if !ok {
+		return noRootErr
+	}
+
+	site, err := shigoto.LoadSite(root)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	entries := make([]listEntry, 0)
+	for _, dir := range []string{"draft", "publish"} {
+		draft := dir == "draft"
+		dir = filepath.Join(root, dir)
+
+		err := common.Walk(dir, func(p string, fi os.FileInfo) error {
+			if fi.IsDir() {
+				return nil
+			}
+
+			c, err := shigoto.ReadContent(dir, p, draft)
+			if err == shigoto.ErrNotContent {
+				return nil
+			}
+			if err != nil {
+				c = shigoto.Content{Path: p, Draft: draft}
+			}
+
+			entry := listEntry{
+				State:  contentState(c, now),
+				Type:   c.Type,
+				Title:  c.Title,
+				Source: filepath.ToSlash(c.SourcePath()),
+				Output: make([]string, 0),
+			}
+			if !c.Time.IsZero() {
+				entry.Time = c.Time.Format(time.RFC3339)
+			}
+			if ((cmd.dtype != "") && (entry.Type != cmd.dtype)) || ((cmd.state != "") && (entry.State != cmd.state)) {
+				return nil
+			}
+
+			problem := func(format string, args ...interface{}) {
+				entry.Problems = append(entry.Problems, fmt.Sprintf(format, args...))
+			}
+
+			switch {
+			case err != nil:
+				problem("%v", err)
+
+			case c.Type == "":
+				problem("no type")
+
+			default:
+				if _, ok := site.Tmpl[c.Type]; !ok {
+					problem("unknown type %q", c.Type)
+					break
+				}
+
+				outputs, err := site.OutputPaths(c)
+				if err != nil {
+					problem("%v", err)
+					break
+				}
+				for _, output := range outputs {
+					entry.Output = append(entry.Output, filepath.ToSlash(output))
+				}
+			}
+
+			if err == nil {
+				entry.Problems = append(entry.Problems, checkTimes(c.Meta)...)
+			}
+
+			entries = append(entries, entry)
+			return nil
+		})
+		if (err != nil) && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %q: %v", dir, err)
+		}
+	}
+
+	sort.Slice(entries, func(i1, i2 int) bool {
+		return entries[i1].Source < entries[i2].Source
+	})
+
+	if cmd.json {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tTYPE\tTITLE\tTIME\tSOURCE\tOUTPUT")
+	for _, entry := range entries {
+		var output string
+		switch len(entry.Output) {
+		case 0:
+		case 1:
+			output = entry.Output[0]
+		default:
+			output = fmt.Sprintf("%v (+%v)", entry.Output[0], len(entry.Output)-1)
+		}
+
+		fmt.Fprintf(tw, "%v\t%v\t%q\t%v\t%v\t%v\n", entry.State, entry.Type, entry.Title, entry.Time, entry.Source, output)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		for _, problem := range entry.Problems {
+			fmt.Fprintf(os.Stderr, "Warning: %v: %v\n", entry.Source, problem)
+		}
+	}
+
+	return nil
+}
+
+// contentState returns the state of c, as shown by the list command.
+func contentState(c shigoto.Content, now time.Time) string {
+	switch {
+	case c.Draft:
+		return "draft"
+	case c.Scheduled(now):
+		return "scheduled"
+	case c.Expired(now):
+		return "expired"
+	default:
+		return "published"
+	}
+}
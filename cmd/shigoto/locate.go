@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DeedleFake/shigoto"
+	"github.com/DeedleFake/shigoto/internal/common"
+	"github.com/gosimple/slug"
+)
+
+// locate finds a content file in dir, which is either "draft" or
+// "publish", and returns its path relative to that directory. arg is
+// either a path to the file, relative to dir or to the current
+// directory, or a pattern that is matched against the names of the
+// files in dir and the slugs of their titles. Patterns containing any
+// of the special characters recognized by path.Match are matched as
+// globs against those as well as the files' names with their
+// extensions and their paths relative to dir. Otherwise, a file
+// matches exactly if its name with its extension or its path relative
+// to dir is arg or if its name without its extension or the slug of
+// its title is the slug of arg, and it matches partially if either of
+// the latter contains the slug of arg. Partial matches are only
+// considered if there are no exact ones. Exactly one file must match.
+func locate(root, dir, arg string) (string, error) {
+	dir = filepath.Join(root, dir)
+
+	// Paths are tried relative to dir first so that the result
+	// doesn't depend on the current directory.
+	for _, file := range []string{filepath.Join(dir, arg), arg} {
+		if (file != arg) && filepath.IsAbs(arg) {
+			continue
+		}
+
+		fi, err := os.Stat(file)
+		if (err != nil) || fi.IsDir() {
+			continue
+		}
+
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return "", err
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+
+		rel, err := filepath.Rel(absDir, abs)
+		if (err != nil) || (rel == "..") || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%q is not in the %v directory", arg, filepath.Base(dir))
+		}
+		if _, err := shigoto.ReadContent(dir, rel, false); err == shigoto.ErrNotContent {
+			return "", fmt.Errorf("%q is not content", arg)
+		}
+		return rel, nil
+	}
+
+	glob := strings.ContainsAny(arg, "*?[")
+	argSlug := slug.Make(arg)
+	match := func(s string) bool {
+		if glob {
+			ok, _ := path.Match(arg, s)
+			return ok
+		}
+		return strings.Contains(s, argSlug)
+	}
+
+	var exact, matches []string
+	err := common.Walk(dir, func(p string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			return nil
+		}
+
+		c, err := shigoto.ReadContent(dir, p, false)
+		if err == shigoto.ErrNotContent {
+			return nil
+		}
+
+		base := filepath.Base(p)
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+		var title string
+		if (err == nil) && (c.Title != "") {
+			title = slug.Make(c.Title)
+		}
+
+		if (arg == base) || (filepath.ToSlash(arg) == filepath.ToSlash(p)) {
+			exact = append(exact, p)
+			return nil
+		}
+		if !glob && ((name == argSlug) || ((title != "") && (title == argSlug))) {
+			exact = append(exact, p)
+			return nil
+		}
+
+		if match(name) || (glob && (match(base) || match(filepath.ToSlash(p)))) || ((title != "") && match(title)) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if (err != nil) && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to search %v directory: %v", filepath.Base(dir), err)
+	}
+	if len(exact) != 0 {
+		matches = exact
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("nothing in the %v directory matches %q", filepath.Base(dir), arg)
+	case 1:
+		return matches[0], nil
+	}
+
+	sort.Strings(matches)
+	for i := range matches {
+		matches[i] = fmt.Sprintf("%q", matches[i])
+	}
+	return "", fmt.Errorf("%q matches more than one file: %v", arg, strings.Join(matches, ", "))
+}
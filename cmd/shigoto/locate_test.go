@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	root, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFiles(t, root, map[string]string{
+		"draft/go.md":          "type: post.html\ntitle: Go\n+++++\n",
+		"draft/go-tips.md":     "type: post.html\ntitle: Go Tips\n+++++\n",
+		"draft/sub/notes.md":   "type: post.html\ntitle: Some Notes\n+++++\n",
+		"draft/sub/cover.png":  "not content",
+		"draft/other.md":       "type: post.html\ntitle: Rust\n+++++\n",
+		"draft/other-thing.md": "type: post.html\ntitle: Python Tips\n+++++\n",
+	})
+
+	tests := []struct {
+		arg  string
+		path string
+		err  bool
+	}{
+		{arg: "go", path: "go.md"},
+		{arg: "Go", path: "go.md"},
+		{arg: "go-tips", path: "go-tips.md"},
+		{arg: "Go Tips", path: "go-tips.md"},
+		{arg: "rust", path: "other.md"},
+		{arg: "notes", path: "sub/notes.md"},
+		{arg: "some", path: "sub/notes.md"},
+		{arg: "sub/notes.md", path: "sub/notes.md"},
+		{arg: "notes.md", path: "sub/notes.md"},
+		{arg: "go*", err: true},
+		{arg: "go-t*", path: "go-tips.md"},
+		{arg: "*/*.md", path: "sub/notes.md"},
+		{arg: "tips", err: true},
+		{arg: "oth", err: true},
+		{arg: "missing", err: true},
+		{arg: "sub/cover.png", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			p, err := locate(root, "draft", test.arg)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if filepath.ToSlash(p) != test.path {
+				t.Errorf("expected %q, got %q", test.path, p)
+			}
+		})
+	}
+}
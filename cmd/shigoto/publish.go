@@ -1,16 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/DeedleFake/shigoto"
-	"gopkg.in/yaml.v2"
 )
 
 type publishCmd struct{}
@@ -25,13 +26,42 @@ func (cmd *publishCmd) Desc() string {
 
 func (cmd *publishCmd) Help() string {
 	return `Usage: publish <type> <title>
+       publish <draft>
 
 The publish command publishes an existing draft by moving it from the
-draft directory to the publish directory. It puts it into a directory
-that matches where its output will be placed in the build directory
-when the project is built. It also inserts a timestamp into the
-draft's metadata with the name "time", unless an entry in the metadata
-with that name already exists.`
+draft directory to the publish directory. The draft can be specified
+either by type and title, in which case its file name is determined by
+the type's sourceName, or by a single argument. A single argument is
+either the path to the draft's file, relative to the draft directory
+or to the current directory, or a pattern that matches exactly one
+draft. Patterns containing glob characters, such as *, are matched
+against the draft's file name, with and without its extension, its
+path relative to the draft directory, and the slug of its title. Other
+patterns match any draft whose file name or path relative to the draft
+directory is exactly the pattern, or whose file name, without its
+extension, or title slug contains the slug of the pattern. Drafts that
+match exactly, such as by having a title slug that is the slug of the
+pattern, take precedence over those that only contain it. The type and
+title of a draft specified this way are read from its metadata.
+
+The draft's new file name in the publish directory is always
+determined by sourceName. It puts it into a directory that matches
+where its output will be placed in the build directory when the
+project is built. If the draft is part of a page bundle, its resources
+are moved along with it. Nothing is moved if the new file or any of
+the resources already exist in the publish directory. It also inserts
+a timestamp into the draft's metadata with the name "time", as well as
+the draft's type and title, unless entries in the metadata with those
+names already exist. If a draft that was specified by a single
+argument has no title, its file name without its extension is used as
+its title and is added to its metadata as well so that the draft is
+built into the same place that it was published to. New entries are
+added to the end of the existing metadata, and everything else in the
+file, including the order of the entries, comments, and formatting, is
+left exactly as it was. A draft with no metadata is given new YAML
+metadata. If the new entries can't be added without rewriting the rest
+of the metadata, such as when YAML metadata is written as a flow
+mapping, the draft is left alone and an error is reported instead.`
 }
 
 func (cmd *publishCmd) Flags(fset *flag.FlagSet) {
@@ -40,15 +70,12 @@ func (cmd *publishCmd) Flags(fset *flag.FlagSet) {
 }
 
 func (cmd *publishCmd) Run(args []string) error {
-	var dtype, title string
 	switch len(args) {
-	case 0, 1:
+	case 0:
 		fmt.Fprintf(os.Stderr, "Error: not enough arguments\n\n")
 		return flag.ErrHelp
 
-	case 2:
-		dtype = args[0]
-		title = args[1]
+	case 1, 2:
 
 	default:
 		fmt.Fprintf(os.Stderr, "Error: too many arguments\n\n")
@@ -60,111 +87,209 @@ func (cmd *publishCmd) Run(args []string) error {
 		return noRootErr
 	}
 
-	tmpl, err := shigoto.LoadTmpl(root)
+	site, err := shigoto.LoadSite(root)
 	if err != nil {
 		return err
 	}
 
-	t, ok := tmpl[dtype]
-	if !ok {
-		return fmt.Errorf("unknown type %q", dtype)
+	var dtype, title, src string
+	switch len(args) {
+	case 1:
+		src, err = locate(root, "draft", args[0])
+		if err != nil {
+			return err
+		}
+
+	case 2:
+		dtype = args[0]
+		title = args[1]
+
+		t, ok := site.Tmpl[dtype]
+		if !ok {
+			return fmt.Errorf("unknown type %q", dtype)
+		}
+
+		src, _, err = publishPath(t, dtype, title)
+		if err != nil {
+			return err
+		}
 	}
 
-	fakePages := map[string]interface{}{
-		"Last":    "last-page",
-		"Current": "pages",
+	infile := filepath.Join(root, "draft", src)
+
+	data, err := ioutil.ReadFile(infile)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %v", src, err)
 	}
 
-	sourceName, ok := tmplGet("sourceName", t.Meta).(string)
-	if !ok {
-		return errors.New("sourceName is not a string")
+	var meta map[string]interface{}
+	_, _, err = shigoto.ReadMetaFormat(bytes.NewReader(data), "", &meta)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata from %q: %v", src, err)
 	}
 
-	name, err := metaTmpl(sourceName, map[string]interface{}{
-		"Type":  dtype,
-		"Title": title,
-		"Tmpl":  t.Meta,
-		"Pages": fakePages,
-	})
+	if dtype == "" {
+		dtype, _ = meta["type"].(string)
+		if dtype == "" {
+			return fmt.Errorf("no type in %q", src)
+		}
+		title, _ = meta["title"].(string)
+		if title == "" {
+			// This gets added to the metadata below, as the output of
+			// content without a title wouldn't end up where it's put.
+			title = strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+		}
+	}
+
+	data, err = shigoto.AddMeta(
+		data,
+		shigoto.MetaField{Key: "type", Value: dtype},
+		shigoto.MetaField{Key: "title", Value: title},
+		shigoto.MetaField{Key: "time", Value: time.Now().Format(time.RFC1123)},
+	)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to add metadata to %q: %v", src, err)
 	}
 
-	buildPath, ok := tmplGet("buildPath", t.Meta).(string)
+	t, ok := site.Tmpl[dtype]
 	if !ok {
-		return errors.New("buildPath is not a string")
+		return fmt.Errorf("unknown type %q in %q", dtype, src)
 	}
 
-	path, err := metaTmpl(buildPath, map[string]interface{}{
-		"Type":  dtype,
-		"Title": title,
-		"Tmpl":  t.Meta,
-		"Pages": fakePages,
-	})
+	_, path, err := publishPath(t, dtype, title)
 	if err != nil {
-		return fmt.Errorf("failed to construct buildPath: %v", err)
+		return err
 	}
-	path = filepath.FromSlash(path)
+	outfile := filepath.Join(root, "publish", path)
 
-	infile := filepath.Join(root, "draft", name)
-	outfile := filepath.Join(root, "publish", filepath.Dir(path), name)
+	_, err = os.Stat(outfile)
+	if err == nil {
+		return fmt.Errorf("published content %q already exists", path)
+	}
 
-	in, err := os.Open(infile)
+	draftDir := filepath.Join(root, "draft")
+	resources, err := shigoto.ReadResources(draftDir, src, true)
+	if err != nil {
+		return err
+	}
+	err = checkResources(filepath.Join(root, "publish"), filepath.Dir(path), resources)
 	if err != nil {
-		return fmt.Errorf("failed to open %q: %v", name, err)
+		return err
 	}
-	defer in.Close()
 
-	meta := make(map[string]interface{}, 3)
-	inr, err := shigoto.ReadMeta(in, &meta)
+	err = os.MkdirAll(filepath.Dir(outfile), 0755)
 	if err != nil {
-		return fmt.Errorf("failed to read metadata from %q: %v", name, err)
+		return fmt.Errorf("failed to create %q: %v", filepath.Dir(path), err)
 	}
-	if _, ok := meta["type"]; !ok {
-		meta["type"] = dtype
+
+	out, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %v", path, err)
 	}
-	if _, ok := meta["title"]; !ok {
-		meta["title"] = title
+	_, err = out.Write(data)
+	if cerr := out.Close(); err == nil {
+		err = cerr
 	}
-	if _, ok := meta["time"]; !ok {
-		meta["time"] = time.Now().Format(time.RFC1123)
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %v", path, err)
 	}
 
-	err = os.MkdirAll(filepath.Dir(outfile), 0755)
+	err = os.Remove(infile)
 	if err != nil {
-		return fmt.Errorf("failed to create %q: %v", path, err)
+		return fmt.Errorf("failed to remove draft: %v", err)
 	}
 
-	out, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	err = moveResources(draftDir, filepath.Join(root, "publish"), filepath.Dir(path), resources)
 	if err != nil {
-		return fmt.Errorf("failed to create %q: %v", filepath.Join(filepath.Dir(path), name), err)
+		return err
 	}
-	defer out.Close()
+	removeEmptyDirs(draftDir, filepath.Dir(src))
 
-	e := yaml.NewEncoder(out)
-	err = e.Encode(meta)
-	if err != nil {
-		return fmt.Errorf("failed to encode metadata: %v", err)
+	return nil
+}
+
+// checkResources returns an error if any of resources already exist
+// in dir relative to to.
+func checkResources(to, dir string, resources []shigoto.Resource) error {
+	for _, r := range resources {
+		p := filepath.Join(dir, filepath.FromSlash(r.Name))
+		if _, err := os.Stat(filepath.Join(to, p)); err == nil {
+			return fmt.Errorf("resource %q already exists", p)
+		}
 	}
-	err = e.Close()
-	if err != nil {
-		return fmt.Errorf("failed to encode metadata: %v", err)
+	return nil
+}
+
+// moveResources moves resources from the directory from, which is the
+// directory that their paths are relative to, into dir relative to
+// to, keeping their paths relative to the content that they belong to
+// and removing any directories in from that are left empty.
+func moveResources(from, to, dir string, resources []shigoto.Resource) error {
+	for _, r := range resources {
+		p := filepath.Join(dir, filepath.FromSlash(r.Name))
+
+		err := os.MkdirAll(filepath.Join(to, filepath.Dir(p)), 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create %q: %v", filepath.Dir(p), err)
+		}
+
+		err = os.Rename(filepath.Join(from, r.Path), filepath.Join(to, p))
+		if err != nil {
+			return fmt.Errorf("failed to move resource %q: %v", r.Path, err)
+		}
+		removeEmptyDirs(from, filepath.Dir(r.Path))
+	}
+
+	return nil
+}
+
+// publishPath returns the sourceName of content of type t with the
+// given title along with the path, relative to the publish directory,
+// that the content is moved to when it is published.
+func publishPath(t shigoto.Tmpl, dtype, title string) (name, path string, err error) {
+	fakePages := map[string]interface{}{
+		"Last":    "last-page",
+		"Current": "pages",
 	}
 
-	_, err = io.WriteString(out, "\n++++++++++\n")
+	sourceName, ok := shigoto.TmplGet("sourceName", t.Meta).(string)
+	if !ok {
+		return "", "", errors.New("sourceName is not a string")
+	}
+
+	name, err = shigoto.MetaTmpl(sourceName, map[string]interface{}{
+		"Type":  dtype,
+		"Title": title,
+		"Tmpl":  t.Meta,
+		"Pages": fakePages,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to write: %v", err)
+		return "", "", err
+	}
+
+	buildPath, ok := shigoto.TmplGet("buildPath", t.Meta).(string)
+	if !ok {
+		return "", "", errors.New("buildPath is not a string")
 	}
 
-	_, err = io.Copy(out, inr)
+	path, err = shigoto.MetaTmpl(buildPath, map[string]interface{}{
+		"Type":  dtype,
+		"Title": title,
+		"Tmpl":  t.Meta,
+		"Pages": fakePages,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to write: %v", err)
+		return "", "", fmt.Errorf("failed to construct buildPath: %v", err)
+	}
+	path, err = shigoto.CleanPath(path)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid buildPath for %q: %v", title, err)
 	}
 
-	err = os.Remove(infile)
+	name, err = shigoto.CleanPath(name)
 	if err != nil {
-		return fmt.Errorf("failed to remove draft: %v", err)
+		return "", "", fmt.Errorf("invalid sourceName for %q: %v", title, err)
 	}
 
-	return nil
+	return name, filepath.Join(filepath.Dir(path), name), nil
 }
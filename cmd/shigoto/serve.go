@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DeedleFake/shigoto"
+)
+
+const reloadPath = "/_shigoto/reload"
+
+const reloadScript = `<script>new EventSource("` + reloadPath + `").onmessage = function() { location.reload(); };</script>`
+
+type serveCmd struct {
+	addr     string
+	output   string
+	interval time.Duration
+	content  contentFlags
+}
+
+func (cmd *serveCmd) Name() string {
+	return "serve"
+}
+
+func (cmd *serveCmd) Desc() string {
+	return "serves a live preview of the output"
+}
+
+func (cmd *serveCmd) Help() string {
+	return `Usage: serve [flags]
+
+The serve command builds the project and serves the output over HTTP,
+rebuilding it whenever something changes in the same way as the watch
+command. A small script is injected into every HTML page that is
+served that causes browsers to reload the page automatically after
+each successful rebuild.
+
+By default, the output is built into a temporary directory that is
+removed when the command exits. Use -o to build into a directory
+relative to the project root instead.
+
+The -drafts, -future, -expired, and -now flags work the same way as
+they do for the watch command.`
+}
+
+func (cmd *serveCmd) Flags(fset *flag.FlagSet) {
+	fset.StringVar(&cmd.addr, "addr", "localhost:8080", "address to serve on")
+	fset.StringVar(&cmd.output, "o", "", "output directory name relative to project root")
+	fset.DurationVar(&cmd.interval, "interval", 500*time.Millisecond, "how often to check for changes")
+	cmd.content.register(fset)
+}
+
+func (cmd *serveCmd) Run(args []string) error {
+	root, ok := shigoto.FindRoot(globalOptions.root)
+	if !ok {
+		return noRootErr
+	}
+
+	output := filepath.Join(root, cmd.output)
+	if cmd.output == "" {
+		tmp, err := ioutil.TempDir("", "shigoto")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(tmp)
+
+		output = tmp
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var reload reloader
+
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, &reload)
+	mux.Handle("/", &previewHandler{dir: output})
+
+	lis, err := net.Listen("tcp", cmd.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(lis)
+	defer server.Close()
+
+	fmt.Fprintf(os.Stderr, "Serving on http://%v/\n", lis.Addr())
+
+	b := &builder{
+		root:    root,
+		output:  output,
+		content: cmd.content,
+	}
+	err = watch(ctx, root, cmd.interval, cmd.content.drafts, func() error {
+		err := b.build()
+		if err != nil {
+			return err
+		}
+
+		reload.notify()
+		return nil
+	})
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
+
+// previewHandler serves files from dir, injecting the reload script
+// into HTML pages.
+type previewHandler struct {
+	dir string
+}
+
+func (h *previewHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	files := http.FileServer(http.Dir(h.dir))
+
+	upath := path.Clean("/" + req.URL.Path)
+	file := filepath.Join(h.dir, filepath.FromSlash(upath))
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		files.ServeHTTP(rw, req)
+		return
+	}
+	if fi.IsDir() {
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			// Let the file server handle the redirect.
+			files.ServeHTTP(rw, req)
+			return
+		}
+
+		file = filepath.Join(file, "index.html")
+	}
+
+	switch filepath.Ext(file) {
+	case ".html", ".htm":
+	default:
+		files.ServeHTTP(rw, req)
+		return
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		files.ServeHTTP(rw, req)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(rw, req, filepath.Base(file), time.Time{}, bytes.NewReader(injectReload(data)))
+}
+
+// injectReload inserts the reload script into an HTML page just
+// before the closing body tag, or at the end if there isn't one.
+func injectReload(page []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i < 0 {
+		i = len(page)
+	}
+
+	out := make([]byte, 0, len(page)+len(reloadScript))
+	out = append(out, page[:i]...)
+	out = append(out, reloadScript...)
+	return append(out, page[i:]...)
+}
+
+// reloader is an HTTP handler that tells clients to reload via
+// server-sent events.
+type reloader struct {
+	m       sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func (r *reloader) notify() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for c := range r.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *reloader) add() chan struct{} {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.clients == nil {
+		r.clients = make(map[chan struct{}]struct{})
+	}
+
+	c := make(chan struct{}, 1)
+	r.clients[c] = struct{}{}
+	return c
+}
+
+func (r *reloader) remove(c chan struct{}) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	delete(r.clients, c)
+}
+
+func (r *reloader) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c := r.add()
+	defer r.remove(c)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-c:
+			_, err := fmt.Fprint(rw, "data: reload\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -36,7 +36,13 @@ or other, similar sources.
 	commander.Register(&initCmd{})
 	commander.Register(&draftCmd{})
 	commander.Register(&publishCmd{})
+	commander.Register(&unpublishCmd{})
+	commander.Register(&listCmd{})
+	commander.Register(&checkCmd{})
 	commander.Register(&buildCmd{})
+	commander.Register(&watchCmd{})
+	commander.Register(&serveCmd{})
+	commander.Register(&deployCmd{})
 	commander.Register(&cleanCmd{})
 
 	err := commander.Run(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...))
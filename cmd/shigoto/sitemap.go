@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/DeedleFake/shigoto"
+)
+
+// maxSitemapURLs is the maximum number of URLs that a single sitemap
+// file may contain.
+const maxSitemapURLs = 50000
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapSource is the source of the files that are generated by
+// build -sitemap. Its name is also the key that they are recorded
+// under in the cache.
+var sitemapSource = outputSource{name: "-sitemap"}
+
+// sitemapURLs returns the sitemap entries for the HTML output files of
+// content, sorted by URL. Drafts, content with a false sitemap
+// metadata field, and pages whose output is produced by something else
+// according to outputs are skipped.
+func sitemapURLs(site *shigoto.Site, content []shigoto.Content, outputs map[string][]outputSource, abs func(string) string) []sitemapURL {
+	var urls []sitemapURL
+	for _, c := range content {
+		if c.Draft {
+			continue
+		}
+
+		t := site.Tmpl[c.Type]
+		if include, ok := shigoto.TmplGet("sitemap", c.Meta, t.Meta).(bool); ok && !include {
+			continue
+		}
+
+		lastMod := c.Time
+		if u, ok := c.Meta["updated"]; ok {
+			if u, err := shigoto.ParseTime(u); err == nil {
+				lastMod = u
+			}
+		}
+
+		paths, err := site.OutputPaths(c)
+		if err != nil {
+			continue
+		}
+
+		for i, file := range paths {
+			switch filepath.Ext(file) {
+			case ".html", ".htm":
+			default:
+				continue
+			}
+			if sources := outputs[file]; sources[len(sources)-1] != (outputSource{name: c.SourcePath(), page: i + 1}) {
+				continue
+			}
+
+			u := sitemapURL{Loc: abs(shigoto.PathURL(file))}
+			if !lastMod.IsZero() {
+				u.LastMod = lastMod.Format(time.RFC3339)
+			}
+			urls = append(urls, u)
+		}
+	}
+
+	sort.Slice(urls, func(i1, i2 int) bool {
+		return urls[i1].Loc < urls[i2].Loc
+	})
+
+	return urls
+}
+
+// sitemapFiles returns the names of the files that writeSitemap
+// writes for n URLs.
+func sitemapFiles(n int) []string {
+	files := []string{"sitemap.xml", "robots.txt"}
+	if n > maxSitemapURLs {
+		for i := 0; i*maxSitemapURLs < n; i++ {
+			files = append(files, fmt.Sprintf("sitemap-%v.xml", i+1))
+		}
+	}
+	return files
+}
+
+// writeSitemap writes sitemap.xml and robots.txt into output. If
+// there are too many URLs for a single sitemap, they are split into
+// several files and sitemap.xml becomes an index of them.
+func writeSitemap(output string, urls []sitemapURL, abs func(string) string) error {
+	if len(urls) <= maxSitemapURLs {
+		err := writeURLSet(output, "sitemap.xml", urls)
+		if err != nil {
+			return err
+		}
+	} else {
+		type sitemap struct {
+			Loc string `xml:"loc"`
+		}
+		type sitemapIndex struct {
+			XMLName  xml.Name  `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+			Sitemaps []sitemap `xml:"sitemap"`
+		}
+
+		var index sitemapIndex
+		for i := 0; i*maxSitemapURLs < len(urls); i++ {
+			end := (i + 1) * maxSitemapURLs
+			if end > len(urls) {
+				end = len(urls)
+			}
+
+			name := fmt.Sprintf("sitemap-%v.xml", i+1)
+			err := writeURLSet(output, name, urls[i*maxSitemapURLs:end])
+			if err != nil {
+				return err
+			}
+			index.Sitemaps = append(index.Sitemaps, sitemap{Loc: abs("/" + name)})
+		}
+
+		err := writeXMLFile(output, "sitemap.xml", index)
+		if err != nil {
+			return err
+		}
+	}
+
+	robots := fmt.Sprintf("User-agent: *\nAllow: /\n\nSitemap: %v\n", abs("/sitemap.xml"))
+	return writeFile(output, "robots.txt", robots)
+}
+
+func writeURLSet(output, name string, urls []sitemapURL) error {
+	type urlSet struct {
+		XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []sitemapURL `xml:"url"`
+	}
+
+	return writeXMLFile(output, name, urlSet{URLs: urls})
+}
+
+func writeXMLFile(output, name string, v interface{}) error {
+	file, err := createOutput(output, name)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %v", name, err)
+	}
+	defer file.Close()
+
+	_, err = io.WriteString(file, xml.Header)
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %v", name, err)
+	}
+
+	e := xml.NewEncoder(file)
+	e.Indent("", "\t")
+	err = e.Encode(v)
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %v", name, err)
+	}
+
+	_, err = io.WriteString(file, "\n")
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %v", name, err)
+	}
+
+	return file.Close()
+}
+
+func writeFile(output, name, data string) error {
+	file, err := createOutput(output, name)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %v", name, err)
+	}
+	defer file.Close()
+
+	_, err = io.WriteString(file, data)
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %v", name, err)
+	}
+
+	return file.Close()
+}
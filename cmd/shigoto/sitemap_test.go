@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSitemapFiles(t *testing.T) {
+	tests := []struct {
+		n     int
+		files []string
+	}{
+		{0, []string{"sitemap.xml", "robots.txt"}},
+		{maxSitemapURLs, []string{"sitemap.xml", "robots.txt"}},
+		{maxSitemapURLs + 1, []string{"sitemap.xml", "robots.txt", "sitemap-1.xml", "sitemap-2.xml"}},
+	}
+
+	for _, test := range tests {
+		files := sitemapFiles(test.n)
+		if !reflect.DeepEqual(files, test.files) {
+			t.Errorf("%v: expected %v, got %v", test.n, test.files, files)
+		}
+	}
+}
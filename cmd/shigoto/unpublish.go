@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DeedleFake/shigoto"
+)
+
+type unpublishCmd struct {
+	output    string
+	stripTime bool
+}
+
+func (cmd *unpublishCmd) Name() string {
+	return "unpublish"
+}
+
+func (cmd *unpublishCmd) Desc() string {
+	return "moves published content back into drafts"
+}
+
+func (cmd *unpublishCmd) Help() string {
+	return `Usage: unpublish [flags] <type> <title>
+       unpublish [flags] <content>
+
+The unpublish command does the reverse of the publish command. It
+moves published content from the publish directory back into the
+draft directory, removing any directories in the publish directory
+that are left empty. The content can be specified either by type and
+title, in which case it is located in the same way that the publish
+command decides where to put it, or by a path or pattern in the same
+way that the publish command finds drafts.
+
+If the content is part of a page bundle, its resources are moved along
+with it into a directory of its own in the draft directory. If the
+content's output exists in the output directory, it is removed as
+well, along with that of its resources.
+
+If -strip-time is given, the "time" field is removed from the
+content's metadata so that publishing it again sets it to the new time
+of publication. The rest of the file is left exactly as it was.
+
+The path of the new draft is printed to stdout.`
+}
+
+func (cmd *unpublishCmd) Flags(fset *flag.FlagSet) {
+	fset.StringVar(&cmd.output, "o", "build", "output directory name relative to project root")
+	fset.BoolVar(&cmd.stripTime, "strip-time", false, "remove the time field from the content's metadata")
+}
+
+func (cmd *unpublishCmd) Run(args []string) error {
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(os.Stderr, "Error: not enough arguments\n\n")
+		return flag.ErrHelp
+
+	case 1, 2:
+
+	default:
+		fmt.Fprintf(os.Stderr, "Error: too many arguments\n\n")
+		return flag.ErrHelp
+	}
+
+	root, ok := shigoto.FindRoot(globalOptions.root)
+	if !ok {
+		return noRootErr
+	}
+
+	site, err := shigoto.LoadSite(root)
+	if err != nil {
+		return err
+	}
+	site.Future = true
+	site.Expired = true
+
+	publishDir := filepath.Join(root, "publish")
+
+	var path string
+	switch len(args) {
+	case 1:
+		path, err = locate(root, "publish", args[0])
+		if err != nil {
+			return err
+		}
+
+	case 2:
+		t, ok := site.Tmpl[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown type %q", args[0])
+		}
+
+		_, path, err = publishPath(t, args[0], args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only the content being unpublished is read so that problems with
+	// the rest of the site don't get in the way.
+	if _, err := os.Stat(filepath.Join(publishDir, path)); err != nil {
+		return fmt.Errorf("no published content at %q", path)
+	}
+	c, err := shigoto.ReadContent(publishDir, path, false)
+	if err != nil {
+		if err == shigoto.ErrNotContent {
+			return fmt.Errorf("%q is not content", path)
+		}
+		return err
+	}
+
+	// Invalid metadata doesn't need to stop the content from being
+	// unpublished, but defaults can still affect its output paths.
+	site.ApplySchema(&c)
+
+	c.Resources, err = shigoto.ReadResources(publishDir, path, false)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	if t, ok := site.Tmpl[c.Type]; ok {
+		name, _, err = publishPath(t, c.Type, c.Title)
+		if err != nil {
+			return err
+		}
+	}
+
+	output := filepath.Join(root, cmd.output)
+	cache, err := loadCache(root, output)
+	if err != nil {
+		return err
+	}
+	files := cache[c.SourcePath()].Files
+	if files == nil {
+		files, err = site.OutputPaths(c)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: can't determine the output of %q to remove it: %v\n", path, err)
+		}
+	}
+
+	// Content with resources gets a directory of its own so that they
+	// stay bundled with it.
+	if len(c.Resources) != 0 {
+		name = filepath.Join(strings.TrimSuffix(name, filepath.Ext(name)), name)
+	}
+
+	draftDir := filepath.Join(root, "draft")
+	infile := filepath.Join(publishDir, path)
+	outfile := filepath.Join(draftDir, name)
+
+	_, err = os.Stat(outfile)
+	if err == nil {
+		return fmt.Errorf("draft %q already exists", name)
+	}
+	err = checkResources(draftDir, filepath.Dir(name), c.Resources)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(outfile), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %v", filepath.Dir(name), err)
+	}
+
+	if cmd.stripTime {
+		data, err := ioutil.ReadFile(infile)
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %v", path, err)
+		}
+		data, err = shigoto.RemoveMeta(data, "time")
+		if err != nil {
+			return fmt.Errorf("failed to remove time from %q: %v", path, err)
+		}
+
+		out, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create %q: %v", name, err)
+		}
+		_, err = out.Write(data)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %q: %v", name, err)
+		}
+
+		err = os.Remove(infile)
+		if err != nil {
+			return fmt.Errorf("failed to remove %q: %v", path, err)
+		}
+	} else {
+		err = os.Rename(infile, outfile)
+		if err != nil {
+			return fmt.Errorf("failed to move %q: %v", path, err)
+		}
+	}
+	err = moveResources(publishDir, draftDir, filepath.Dir(name), c.Resources)
+	if err != nil {
+		return err
+	}
+	removeEmptyDirs(publishDir, filepath.Dir(path))
+
+	for _, file := range files {
+		err := os.Remove(filepath.Join(output, file))
+		if (err != nil) && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove output %q: %v", file, err)
+		}
+		removeEmptyDirs(output, filepath.Dir(file))
+	}
+
+	fmt.Println(outfile)
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DeedleFake/shigoto"
+	"github.com/DeedleFake/shigoto/internal/common"
+)
+
+type watchCmd struct {
+	output   string
+	interval time.Duration
+	content  contentFlags
+}
+
+func (cmd *watchCmd) Name() string {
+	return "watch"
+}
+
+func (cmd *watchCmd) Desc() string {
+	return "rebuilds output whenever the project changes"
+}
+
+func (cmd *watchCmd) Help() string {
+	return `Usage: watch [flags]
+
+The watch command builds the project the same way that the build
+command does and then continues to watch the tmpl, publish, data, and
+static directories for changes, rebuilding every time that something
+changes. Errors during a rebuild are printed, but do not stop the
+command.
+
+Changes are detected by periodically scanning the directories, so no
+special support from the operating system is necessary. A burst of
+changes only results in a single rebuild once things have settled
+down.
+
+The -drafts, -future, -expired, and -now flags work the same way as
+they do for the build command. If -drafts is given, the draft
+directory is watched as well.`
+}
+
+func (cmd *watchCmd) Flags(fset *flag.FlagSet) {
+	fset.StringVar(&cmd.output, "o", "build", "output directory name relative to project root")
+	fset.DurationVar(&cmd.interval, "interval", 500*time.Millisecond, "how often to check for changes")
+	cmd.content.register(fset)
+}
+
+func (cmd *watchCmd) Run(args []string) error {
+	root, ok := shigoto.FindRoot(globalOptions.root)
+	if !ok {
+		return noRootErr
+	}
+
+	b := &builder{
+		root:    root,
+		output:  filepath.Join(root, cmd.output),
+		content: cmd.content,
+	}
+	return watch(context.Background(), root, cmd.interval, cmd.content.drafts, b.build)
+}
+
+// watch runs rebuild once and then again every time that the project
+// rooted at root changes, until ctx is canceled.
+func watch(ctx context.Context, root string, interval time.Duration, draft bool, rebuild func() error) error {
+	dirs := []string{
+		filepath.Join(root, "tmpl"),
+		filepath.Join(root, "publish"),
+		filepath.Join(root, "static"),
+		filepath.Join(root, "data"),
+	}
+	if draft {
+		dirs = append(dirs, filepath.Join(root, "draft"))
+	}
+
+	run := func() {
+		start := time.Now()
+		err := rebuild()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Built in %v\n", time.Since(start).Round(time.Millisecond))
+	}
+
+	run()
+	return common.Watch(ctx, interval, dirs, run)
+}
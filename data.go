@@ -0,0 +1,148 @@
+package shigoto
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DeedleFake/shigoto/internal/common"
+)
+
+// A DataError is an error that occurred while loading a file from the
+// data directory.
+type DataError struct {
+	// Path is the path of the file relative to the data directory.
+	Path string
+	Err  error
+}
+
+func (err DataError) Error() string {
+	return fmt.Sprintf("failed to load data from %q: %v", err.Path, err.Err)
+}
+
+// dataFormats maps the extensions of the files in the data directory
+// that are loaded to their formats. CSV files are handled separately.
+var dataFormats = map[string]MetaFormat{
+	".yaml": YAML,
+	".yml":  YAML,
+	".toml": TOML,
+	".json": JSON,
+}
+
+// loadData loads every data file in root into a nested map keyed by
+// their paths, without their extensions. For example, the file at
+// nav/main.yaml is available at data["nav"]["main"]. Files with
+// unknown extensions are ignored. Files that fail to load are skipped,
+// and the errors that occurred are returned along with the rest of
+// the data. A root that doesn't exist simply results in no data.
+func loadData(root string) (map[string]interface{}, []error) {
+	data := make(map[string]interface{})
+	var errs []error
+	err := common.Walk(root, func(p string, fi os.FileInfo) error {
+		ext := strings.ToLower(filepath.Ext(p))
+		if _, ok := dataFormats[ext]; fi.IsDir() || (!ok && (ext != ".csv")) {
+			return nil
+		}
+
+		v, err := readData(filepath.Join(root, p))
+		if err != nil {
+			errs = append(errs, DataError{Path: p, Err: err})
+			return nil
+		}
+
+		keys := strings.Split(filepath.ToSlash(strings.TrimSuffix(p, filepath.Ext(p))), "/")
+		err = setData(data, keys, v)
+		if err != nil {
+			errs = append(errs, DataError{Path: p, Err: err})
+		}
+		return nil
+	})
+	if (err != nil) && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	return data, errs
+}
+
+// readData reads the data file at path.
+func readData(path string) (interface{}, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".csv" {
+		return readCSV(raw)
+	}
+
+	var v interface{}
+	if dataFormats[ext] == TOML {
+		// TOML documents are always tables.
+		var m map[string]interface{}
+		err = unmarshalMeta(TOML, raw, &m)
+		v = m
+	} else {
+		err = unmarshalMeta(dataFormats[ext], raw, &v)
+	}
+	return v, err
+}
+
+// readCSV parses raw as a CSV file whose first row names its columns,
+// returning a list with an object for each of the other rows.
+func readCSV(raw []byte) (interface{}, error) {
+	records, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]interface{}, 0, len(records))
+	if len(records) == 0 {
+		return rows, nil
+	}
+
+	header := records[0]
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// dataDir is the data loaded from a directory in the data directory.
+// It is distinct from map[string]interface{} so that directories can
+// be told apart from files that contain objects.
+type dataDir map[string]interface{}
+
+// setData sets the value at keys in data to v, creating nested maps as
+// necessary.
+func setData(data map[string]interface{}, keys []string, v interface{}) error {
+	for i, key := range keys[:len(keys)-1] {
+		switch next := data[key].(type) {
+		case nil:
+			m := make(dataDir)
+			data[key] = m
+			data = m
+
+		case dataDir:
+			data = next
+
+		default:
+			return fmt.Errorf("conflicts with the file for %q", strings.Join(keys[:i+1], "/"))
+		}
+	}
+
+	key := keys[len(keys)-1]
+	if _, ok := data[key]; ok {
+		return fmt.Errorf("conflicts with another file or directory for %q", strings.Join(keys, "/"))
+	}
+	data[key] = v
+	return nil
+}
@@ -0,0 +1,442 @@
+package shigoto
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FeedInfo is the parsed form of the feed metadata field.
+type FeedInfo struct {
+	Tmpl   string `yaml:"tmpl"`
+	Limit  int    `yaml:"limit"`
+	Format string `yaml:"format"`
+}
+
+func (info FeedInfo) fromRaw(raw interface{}) interface{} {
+	rawmap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if tmpl, ok := rawmap["tmpl"].(string); ok {
+		info.Tmpl = tmpl
+	}
+	if limit, ok := rawmap["limit"].(int); ok {
+		info.Limit = limit
+	}
+	if format, ok := rawmap["format"].(string); ok {
+		info.Format = format
+	}
+
+	return info
+}
+
+// Render renders c using its template, but not any of the templates
+// that that template inherits from.
+func (site *Site) Render(c Content) (string, error) {
+	t, ok := site.Tmpl[c.Type]
+	if !ok {
+		return "", fmt.Errorf("unknown type %q in %q", c.Type, c.Path)
+	}
+
+	intmpl, err := site.ParseContent(c)
+	if err != nil {
+		return "", err
+	}
+
+	data := map[string]interface{}{
+		"Type":      c.Type,
+		"Title":     c.Title,
+		"Tmpl":      t.Meta,
+		"Meta":      c.Meta,
+		"Draft":     c.Draft,
+		"Pages":     PagesInfo{Per: 1}.PageMap(1, 0),
+		"Data":      site.Data,
+		"Resources": c.Resources,
+	}
+
+	var content strings.Builder
+	err = intmpl.Tmpl.Execute(&content, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute %q: %v", c.Path, err)
+	}
+	data["Content"] = htmltemplate.HTML(content.String())
+
+	var out strings.Builder
+	err = t.Tmpl.Execute(&out, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute %q: %v", c.Path, err)
+	}
+
+	return out.String(), nil
+}
+
+type feedItem struct {
+	Title     string
+	Link      string
+	Author    string
+	Summary   string
+	Content   string
+	Published time.Time
+	Updated   time.Time
+}
+
+type feed struct {
+	Title       string
+	Description string
+	Author      string
+	Link        string
+	Self        string
+	Updated     time.Time
+	Items       []feedItem
+}
+
+// WriteFeed writes a feed of the content described by info to w. The
+// feed's own title, description, and author come from c, which is
+// also where its URL comes from.
+func (site *Site) WriteFeed(w io.Writer, c Content, info FeedInfo) error {
+	t, ok := site.Tmpl[c.Type]
+	if !ok {
+		return fmt.Errorf("unknown type %q in %q", c.Type, c.Path)
+	}
+
+	base, ok := TmplGet("baseURL", c.Meta, t.Meta).(string)
+	if !ok {
+		return fmt.Errorf("feed in %q requires a baseURL", c.Path)
+	}
+	abs, err := AbsURL(base)
+	if err != nil {
+		return fmt.Errorf("invalid baseURL in %q: %v", c.Path, err)
+	}
+
+	items, err := site.ByType(info.Tmpl)
+	if err != nil {
+		return err
+	}
+	sorted := make([]Content, 0, len(items))
+	for _, item := range items {
+		if !item.Draft {
+			sorted = append(sorted, item)
+		}
+	}
+	sort.SliceStable(sorted, func(i1, i2 int) bool {
+		return sorted[i1].Time.After(sorted[i2].Time)
+	})
+	if (info.Limit > 0) && (len(sorted) > info.Limit) {
+		sorted = sorted[:info.Limit]
+	}
+
+	f := feed{
+		Title:       c.Title,
+		Description: metaString(c.Meta, "description"),
+		Author:      metaString(c.Meta, "author"),
+		Link:        abs("/"),
+		Self:        abs(c.URL),
+	}
+	for _, item := range sorted {
+		content, err := site.Render(item)
+		if err != nil {
+			return err
+		}
+
+		updated := item.Time
+		if u, ok := item.Meta["updated"]; ok {
+			if u, err := ParseTime(u); err == nil {
+				updated = u
+			}
+		}
+		if updated.After(f.Updated) {
+			f.Updated = updated
+		}
+
+		f.Items = append(f.Items, feedItem{
+			Title:     item.Title,
+			Link:      abs(item.URL),
+			Author:    metaString(item.Meta, "author"),
+			Summary:   metaString(item.Meta, "summary"),
+			Content:   content,
+			Published: item.Time,
+			Updated:   updated,
+		})
+	}
+
+	switch info.Format {
+	case "rss":
+		return f.writeRSS(w)
+	case "atom":
+		return f.writeAtom(w)
+	case "json":
+		return f.writeJSON(w)
+	default:
+		return fmt.Errorf("unknown feed format %q in %q", info.Format, c.Path)
+	}
+}
+
+// AbsURL returns a function that converts the root-relative URLs
+// of content into absolute URLs for a site located at base.
+func AbsURL(base string) (func(string) string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("%q is not absolute", base)
+	}
+
+	base = strings.TrimSuffix(u.String(), "/")
+	return func(p string) string {
+		return base + p
+	}, nil
+}
+
+func metaString(meta map[string]interface{}, key string) string {
+	s, _ := meta[key].(string)
+	return s
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "\t")
+	err = e.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func (f feed) writeRSS(w io.Writer) error {
+	type guid struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+	type item struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		GUID        guid   `xml:"guid"`
+		PubDate     string `xml:"pubDate,omitempty"`
+		Description string `xml:"description"`
+	}
+	type atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	}
+	type channel struct {
+		Title         string   `xml:"title"`
+		Link          string   `xml:"link"`
+		Description   string   `xml:"description"`
+		AtomLink      atomLink `xml:"atom:link"`
+		LastBuildDate string   `xml:"lastBuildDate,omitempty"`
+		Items         []item   `xml:"item"`
+	}
+	type rss struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Atom    string   `xml:"xmlns:atom,attr"`
+		Channel channel  `xml:"channel"`
+	}
+
+	rssTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC1123Z)
+	}
+
+	description := f.Description
+	if description == "" {
+		description = f.Title
+	}
+
+	doc := rss{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: channel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: description,
+			AtomLink: atomLink{
+				Href: f.Self,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			},
+			LastBuildDate: rssTime(f.Updated),
+		},
+	}
+	for _, fi := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, item{
+			Title:       fi.Title,
+			Link:        fi.Link,
+			GUID:        guid{IsPermaLink: true, Value: fi.Link},
+			PubDate:     rssTime(fi.Published),
+			Description: fi.Content,
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+func (f feed) writeAtom(w io.Writer) error {
+	type link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+	}
+	type author struct {
+		Name string `xml:"name"`
+	}
+	type text struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	}
+	type entry struct {
+		Title     string  `xml:"title"`
+		ID        string  `xml:"id"`
+		Link      link    `xml:"link"`
+		Published string  `xml:"published,omitempty"`
+		Updated   string  `xml:"updated"`
+		Author    *author `xml:"author,omitempty"`
+		Summary   *text   `xml:"summary,omitempty"`
+		Content   text    `xml:"content"`
+	}
+	type atom struct {
+		XMLName  xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Title    string   `xml:"title"`
+		Subtitle string   `xml:"subtitle,omitempty"`
+		ID       string   `xml:"id"`
+		Links    []link   `xml:"link"`
+		Updated  string   `xml:"updated"`
+		Author   author   `xml:"author"`
+		Entries  []entry  `xml:"entry"`
+	}
+
+	atomTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	// Atom requires an author, so fall back to the feed's title if
+	// there isn't one.
+	name := f.Author
+	if name == "" {
+		name = f.Title
+	}
+
+	doc := atom{
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.Self,
+		Links: []link{
+			{Href: f.Link},
+			{Href: f.Self, Rel: "self"},
+		},
+		Updated: atomTime(f.Updated),
+		Author:  author{Name: name},
+	}
+	if doc.Updated == "" {
+		doc.Updated = atomTime(time.Unix(0, 0).UTC())
+	}
+	for _, fi := range f.Items {
+		e := entry{
+			Title:     fi.Title,
+			ID:        fi.Link,
+			Link:      link{Href: fi.Link},
+			Published: atomTime(fi.Published),
+			Updated:   atomTime(fi.Updated),
+			Content:   text{Type: "html", Value: fi.Content},
+		}
+		if e.Updated == "" {
+			e.Updated = doc.Updated
+		}
+		if fi.Author != "" {
+			e.Author = &author{Name: fi.Author}
+		}
+		if fi.Summary != "" {
+			e.Summary = &text{Type: "text", Value: fi.Summary}
+		}
+
+		doc.Entries = append(doc.Entries, e)
+	}
+
+	return writeXML(w, doc)
+}
+
+func (f feed) writeJSON(w io.Writer) error {
+	type author struct {
+		Name string `json:"name"`
+	}
+	type item struct {
+		ID            string   `json:"id"`
+		URL           string   `json:"url"`
+		Title         string   `json:"title,omitempty"`
+		ContentHTML   string   `json:"content_html"`
+		Summary       string   `json:"summary,omitempty"`
+		DatePublished string   `json:"date_published,omitempty"`
+		DateModified  string   `json:"date_modified,omitempty"`
+		Authors       []author `json:"authors,omitempty"`
+	}
+	type jsonFeed struct {
+		Version     string   `json:"version"`
+		Title       string   `json:"title"`
+		HomePageURL string   `json:"home_page_url"`
+		FeedURL     string   `json:"feed_url"`
+		Description string   `json:"description,omitempty"`
+		Authors     []author `json:"authors,omitempty"`
+		Items       []item   `json:"items"`
+	}
+
+	jsonTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.Self,
+		Description: f.Description,
+		Items:       []item{},
+	}
+	if f.Author != "" {
+		doc.Authors = []author{{Name: f.Author}}
+	}
+	for _, fi := range f.Items {
+		i := item{
+			ID:            fi.Link,
+			URL:           fi.Link,
+			Title:         fi.Title,
+			ContentHTML:   fi.Content,
+			Summary:       fi.Summary,
+			DatePublished: jsonTime(fi.Published),
+			DateModified:  jsonTime(fi.Updated),
+		}
+		if fi.Author != "" {
+			i.Authors = []author{{Name: fi.Author}}
+		}
+
+		doc.Items = append(doc.Items, i)
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	e.SetEscapeHTML(false)
+	return e.Encode(doc)
+}
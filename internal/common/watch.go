@@ -0,0 +1,78 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileState struct {
+	size    int64
+	mode    os.FileMode
+	modTime int64
+}
+
+// snapshot records the state of every file in dirs. Directories that
+// don't exist are skipped.
+func snapshot(dirs []string) map[string]fileState {
+	s := make(map[string]fileState)
+	for _, dir := range dirs {
+		_ = Walk(dir, func(p string, fi os.FileInfo) error {
+			s[filepath.Join(dir, p)] = fileState{
+				size:    fi.Size(),
+				mode:    fi.Mode(),
+				modTime: fi.ModTime().UnixNano(),
+			}
+			return nil
+		})
+	}
+	return s
+}
+
+func sameSnapshot(s1, s2 map[string]fileState) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+
+	for p, fs1 := range s1 {
+		fs2, ok := s2[p]
+		if !ok || fs1 != fs2 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Watch polls dirs recursively every interval until ctx is canceled.
+// When something changes, it waits until a full interval passes with
+// no further changes and then calls f, so that a burst of changes,
+// such as an editor saving several files, only results in a single
+// call.
+func Watch(ctx context.Context, interval time.Duration, dirs []string, f func()) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	prev := snapshot(dirs)
+	var dirty bool
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+
+		cur := snapshot(dirs)
+		if !sameSnapshot(prev, cur) {
+			prev = cur
+			dirty = true
+			continue
+		}
+
+		if dirty {
+			dirty = false
+			f()
+		}
+	}
+}
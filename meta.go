@@ -0,0 +1,794 @@
+package shigoto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// MetaFormat is a format that the metadata of a file can be written
+// in.
+type MetaFormat string
+
+const (
+	// YAML metadata is separated from the rest of the file by a line
+	// of at least five plus signs.
+	YAML MetaFormat = "yaml"
+
+	// TOML metadata is surrounded by lines of exactly three plus
+	// signs.
+	TOML MetaFormat = "toml"
+
+	// JSON metadata is a single object at the start of the file,
+	// followed by the same separator line as YAML metadata.
+	JSON MetaFormat = "json"
+)
+
+var (
+	metaSplit  = regexp.MustCompile(`^\+{5,}\r?\n?$`)
+	tomlFence  = regexp.MustCompile(`^\+{3}\r?\n?$`)
+	jsonIndent = regexp.MustCompile(`^\s*\{[ \t]*\r?\n([ \t]*)"`)
+)
+
+// ReadMeta reads the metadata from the start of r into v, detecting
+// its format, and returns a reader that yields the rest of r. See
+// ReadMetaFormat for details.
+func ReadMeta(r io.Reader, v interface{}) (rem io.Reader, err error) {
+	_, rem, err = ReadMetaFormat(r, "", v)
+	return rem, err
+}
+
+// ReadMetaFormat reads the metadata from the start of r into v using
+// the given format and returns a reader that yields the rest of r,
+// along with the format that was used.
+//
+// If format is empty, it is detected: Metadata starting with a line of
+// exactly three plus signs is TOML and ends at the next such line,
+// metadata that is a JSON object followed by a line of at least five
+// plus signs is JSON, and anything else is YAML, which also ends at
+// such a line. If the metadata isn't TOML and there is no such line,
+// all of r is treated as content with no metadata, so content that is
+// itself JSON is never mistaken for metadata.
+//
+// If v is a pointer to a map[string]interface{}, the map that it is
+// set to has the same structure regardless of format: Nested objects
+// are also map[string]interface{}, lists are []interface{}, and
+// integers are ints.
+func ReadMetaFormat(r io.Reader, format MetaFormat, v interface{}) (MetaFormat, io.Reader, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return format, nil, err
+	}
+
+	b, err := splitMeta(data, format)
+	if err != nil {
+		return b.format, nil, err
+	}
+	if !b.found {
+		return b.format, bytes.NewReader(data), nil
+	}
+
+	return b.format, bytes.NewReader(data[b.rem:]), unmarshalMeta(b.format, data[b.start:b.end], v)
+}
+
+// metaBlock describes where the metadata is in a file.
+type metaBlock struct {
+	format MetaFormat
+
+	// found is false if the file has no metadata.
+	found bool
+
+	// start and end are the offsets of the metadata itself, not
+	// including any fences or separators, and rem is the offset at
+	// which the content begins.
+	start, end, rem int
+}
+
+// splitMeta finds the metadata in data. See ReadMetaFormat for details
+// of the formats.
+func splitMeta(data []byte, format MetaFormat) (metaBlock, error) {
+	first := firstLine(data)
+
+	if ((format == "") || (format == TOML)) && tomlFence.Match(first) {
+		start, end, rem, ok := findSep(data, len(first), tomlFence)
+		if !ok {
+			return metaBlock{format: TOML}, fmt.Errorf("unterminated TOML metadata")
+		}
+		return metaBlock{format: TOML, found: true, start: start, end: end, rem: rem}, nil
+	}
+
+	if ((format == "") || (format == JSON)) && isJSON(data) {
+		br := bytes.NewReader(data)
+		d := json.NewDecoder(br)
+		var v interface{}
+		err := d.Decode(&v)
+		if err == nil {
+			buffered, _ := ioutil.ReadAll(d.Buffered())
+			end := len(data) - br.Len() - len(buffered)
+			if n, ok := jsonSep(data[end:]); ok {
+				return metaBlock{format: JSON, found: true, start: 0, end: end, rem: end + n}, nil
+			}
+			err = errors.New("JSON metadata must be followed by a separator line")
+		}
+
+		// Something like a YAML flow mapping might look like JSON at
+		// first glance, so only fail if JSON was asked for.
+		if format == JSON {
+			return metaBlock{format: JSON}, err
+		}
+	}
+
+	if format == "" {
+		format = YAML
+	}
+
+	start, end, rem, ok := findSep(data, 0, metaSplit)
+	return metaBlock{format: format, found: ok, start: start, end: end, rem: rem}, nil
+}
+
+// writeMeta writes meta to w as YAML, followed by a separator line.
+func writeMeta(w io.Writer, meta map[string]interface{}) error {
+	e := yaml.NewEncoder(w)
+	err := e.Encode(meta)
+	if err != nil {
+		return err
+	}
+	err = e.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n++++++++++\n")
+	return err
+}
+
+// findSep finds the first line in data at or after offset from that
+// matches sep. It returns from, the offset of the start of that line,
+// and the offset of the end of it.
+func findSep(data []byte, from int, sep *regexp.Regexp) (start, end, rem int, ok bool) {
+	for cur := from; cur < len(data); {
+		next := cur + len(firstLine(data[cur:]))
+		if sep.Match(data[cur:next]) {
+			return from, cur, next, true
+		}
+		cur = next
+	}
+
+	return 0, 0, 0, false
+}
+
+// isJSON returns true if data looks like it starts with a JSON object.
+// Content often starts with a template action, so "{{" doesn't count.
+func isJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return bytes.HasPrefix(data, []byte("{")) && !bytes.HasPrefix(data, []byte("{{"))
+}
+
+// jsonSep returns the length of the rest of the line that JSON
+// metadata ended on, given the data following the metadata, along with
+// that of the separator line that must follow it. It returns false if
+// there is anything else on the line or if the next line isn't a
+// separator.
+func jsonSep(rem []byte) (int, bool) {
+	trimmed := bytes.TrimLeft(rem, " \t\r")
+	if !bytes.HasPrefix(trimmed, []byte("\n")) {
+		return 0, false
+	}
+	n := len(rem) - len(trimmed) + 1
+
+	line := firstLine(rem[n:])
+	if !metaSplit.Match(line) {
+		return 0, false
+	}
+	return n + len(line), true
+}
+
+// firstLine returns the first line of data, including the newline.
+func firstLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i+1]
+	}
+	return data
+}
+
+func unmarshalMeta(format MetaFormat, data []byte, v interface{}) error {
+	var err error
+	switch format {
+	case YAML:
+		err = yaml.Unmarshal(data, v)
+	case TOML:
+		err = toml.Unmarshal(data, v)
+	case JSON:
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		err = d.Decode(v)
+	default:
+		return fmt.Errorf("unknown metadata format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return normalizeMeta(v)
+}
+
+// normalizeMeta normalizes the structure of v if it's a pointer to a
+// map[string]interface{} or to an interface{}.
+func normalizeMeta(v interface{}) error {
+	switch v := v.(type) {
+	case *map[string]interface{}:
+		if *v != nil {
+			*v = normalize(*v).(map[string]interface{})
+		}
+	case *interface{}:
+		*v = normalize(*v)
+	}
+	return nil
+}
+
+// normalize converts the values decoded by the various metadata
+// formats into the same types.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalize(val)
+		}
+		return v
+
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+
+	case []interface{}:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+		return v
+
+	case []map[string]interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, val := range v {
+			list = append(list, normalize(val))
+		}
+		return list
+
+	case int64:
+		return int(v)
+
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+
+	default:
+		return v
+	}
+}
+
+// MetaField is a single top-level field in a file's metadata.
+type MetaField struct {
+	Key   string
+	Value interface{}
+}
+
+// AddMeta returns data, the contents of a file, with each of fields
+// that isn't already in its metadata added to it. The rest of the file
+// is left exactly as it was. If the file has no metadata, YAML
+// metadata containing fields is added to the start of it. If the
+// fields can't be added without rewriting the rest of the metadata,
+// such as because it's a YAML flow mapping, an error is returned.
+func AddMeta(data []byte, fields ...MetaField) ([]byte, error) {
+	b, err := splitMeta(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.found {
+		meta := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			meta[field.Key] = field.Value
+		}
+
+		var buf bytes.Buffer
+		err := writeMeta(&buf, meta)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		return buf.Bytes(), nil
+	}
+
+	var existing map[string]interface{}
+	err = unmarshalMeta(b.format, data[b.start:b.end], &existing)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []MetaField
+	for _, field := range fields {
+		if _, ok := existing[field.Key]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		return data, nil
+	}
+
+	added := make([]string, 0, len(missing))
+	for _, field := range missing {
+		added = append(added, field.Key)
+	}
+
+	out, err := addMeta(data, b, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkMeta(out, b.format, existing, added)
+	if err != nil {
+		return nil, fmt.Errorf("can't add %v to the %v metadata without rewriting it: %v", strings.Join(added, ", "), strings.ToUpper(string(b.format)), err)
+	}
+	return out, nil
+}
+
+// addMeta inserts fields into the metadata described by b at the end
+// of its top-level fields.
+func addMeta(data []byte, b metaBlock, fields []MetaField) ([]byte, error) {
+	switch b.format {
+	case YAML, TOML:
+		end := b.end
+		if b.format == TOML {
+			// New keys have to go before any tables, or they'd become
+			// part of them.
+			end = b.start + tomlTableStart(data[b.start:b.end])
+		}
+		pos := afterContent(data, b.start, end)
+
+		var buf bytes.Buffer
+		buf.Write(data[:pos])
+		if (pos > b.start) && (data[pos-1] != '\n') {
+			buf.WriteByte('\n')
+		}
+		for _, field := range fields {
+			var err error
+			if b.format == YAML {
+				err = yaml.NewEncoder(&buf).Encode(map[string]interface{}{field.Key: field.Value})
+			} else {
+				err = toml.NewEncoder(&buf).Encode(map[string]interface{}{field.Key: field.Value})
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		buf.Write(data[pos:])
+		return buf.Bytes(), nil
+
+	case JSON:
+		obj := data[b.start:b.end]
+		closing := b.start + bytes.LastIndexByte(obj, '}')
+		pos := b.start + len(bytes.TrimRight(data[b.start:closing], " \t\r\n"))
+		empty := data[pos-1] == '{'
+
+		sep := ", "
+		if m := jsonIndent.FindSubmatch(obj); m != nil {
+			sep = ",\n" + string(m[1])
+		}
+
+		var buf bytes.Buffer
+		buf.Write(data[:pos])
+		for i, field := range fields {
+			if (i > 0) || !empty {
+				buf.WriteString(sep)
+			}
+
+			key, err := json.Marshal(field.Key)
+			if err != nil {
+				return nil, err
+			}
+			val, err := marshalJSON(field.Value)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(key)
+			buf.WriteString(": ")
+			buf.Write(val)
+		}
+		buf.Write(data[pos:])
+		return buf.Bytes(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown metadata format %q", b.format)
+	}
+}
+
+// RemoveMeta returns data, the contents of a file, with the top-level
+// fields with the given keys removed from its metadata. The rest of the
+// file is left exactly as it was. Like AddMeta, it returns an error if
+// that isn't possible.
+func RemoveMeta(data []byte, keys ...string) ([]byte, error) {
+	b, err := splitMeta(data, "")
+	if err != nil {
+		return nil, err
+	}
+	if !b.found {
+		return data, nil
+	}
+
+	var existing map[string]interface{}
+	err = unmarshalMeta(b.format, data[b.start:b.end], &existing)
+	if err != nil {
+		return nil, err
+	}
+
+	remove := make(map[string]bool, len(keys))
+	keep := make(map[string]interface{}, len(existing))
+	for key, v := range existing {
+		keep[key] = v
+	}
+	var removed []string
+	for _, key := range keys {
+		if _, ok := existing[key]; ok && !remove[key] {
+			removed = append(removed, key)
+		}
+		remove[key] = true
+		delete(keep, key)
+	}
+	if len(removed) == 0 {
+		return data, nil
+	}
+
+	out, err := removeMeta(data, b, remove)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkMeta(out, b.format, keep, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't remove %v from the %v metadata without rewriting it: %v", strings.Join(removed, ", "), strings.ToUpper(string(b.format)), err)
+	}
+	return out, nil
+}
+
+// removeMeta removes the top-level fields in remove from the metadata
+// described by b.
+func removeMeta(data []byte, b metaBlock, remove map[string]bool) ([]byte, error) {
+	var buf bytes.Buffer
+	switch b.format {
+	case YAML, TOML:
+		buf.Write(data[:b.start])
+
+		meta := data[b.start:b.end]
+		top := make(map[int]bool)
+		tableStart := len(meta)
+		if b.format == TOML {
+			for _, i := range tomlTopLines(meta) {
+				top[i] = true
+			}
+			tableStart = tomlTableStart(meta)
+		}
+
+		var skipping bool
+		for cur := 0; cur < len(meta); {
+			line := firstLine(meta[cur:])
+			start := cur
+			cur += len(line)
+
+			if skipping && continues(b.format, line, top[start]) {
+				continue
+			}
+			skipping = false
+
+			if key, ok := metaKey(b.format, line); ok && (start < tableStart) && remove[key] {
+				skipping = true
+				continue
+			}
+			buf.Write(line)
+		}
+
+		buf.Write(data[b.end:])
+		return buf.Bytes(), nil
+
+	case JSON:
+		members, err := jsonMembers(data[b.start:b.end])
+		if err != nil {
+			return nil, err
+		}
+
+		// Each member is removed along with the separator before it,
+		// or the one after it if it's the first.
+		prev := -1
+		last := b.start
+		for i, m := range members {
+			if !remove[m.key] {
+				prev = i
+				continue
+			}
+
+			switch {
+			case prev >= 0:
+				buf.Write(data[last : b.start+members[prev].end])
+				last = b.start + m.end
+			case i+1 < len(members):
+				buf.Write(data[last : b.start+m.start])
+				last = b.start + members[i+1].start
+				members[i+1].start = m.start
+			default:
+				buf.Write(data[last : b.start+m.start])
+				last = b.start + m.end
+			}
+		}
+		buf.Write(data[last:])
+		return buf.Bytes(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown metadata format %q", b.format)
+	}
+}
+
+var (
+	yamlKey = regexp.MustCompile(`^(?:"([^"]*)"|'([^']*)'|([^\s#:'"][^:]*?))[ \t]*:(?:\s|$)`)
+	tomlKey = regexp.MustCompile(`^[ \t]*(?:"([^"]*)"|'([^']*)'|([A-Za-z0-9_-]+))[ \t]*=`)
+)
+
+// metaKey returns the top-level key that is set on line of metadata in
+// the given format, if any.
+func metaKey(format MetaFormat, line []byte) (string, bool) {
+	re := yamlKey
+	if format == TOML {
+		re = tomlKey
+	}
+
+	m := re.FindSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	return string(m[1]) + string(m[2]) + string(m[3]), true
+}
+
+// continues returns true if line, which follows a line that sets a
+// top-level field in metadata of the given format, is part of that
+// field's value. top is true if a TOML line doesn't begin inside of a
+// multi-line value.
+func continues(format MetaFormat, line []byte, top bool) bool {
+	if format == TOML {
+		return !top
+	}
+
+	// Indented lines, as well as the items of a list that isn't
+	// indented, following a YAML field are part of its value.
+	if len(line) == 0 {
+		return false
+	}
+	if (line[0] == ' ') || (line[0] == '\t') {
+		return true
+	}
+	return (line[0] == '-') && ((len(line) == 1) || bytes.IndexByte([]byte(" \t\r\n"), line[1]) >= 0)
+}
+
+// checkMeta returns an error unless the metadata in data, which is in
+// the given format, contains exactly the fields in keep, with the same
+// values, along with the fields named in added.
+func checkMeta(data []byte, format MetaFormat, keep map[string]interface{}, added []string) error {
+	b, err := splitMeta(data, format)
+	if err != nil {
+		return err
+	}
+	if !b.found {
+		return errors.New("metadata is missing")
+	}
+
+	var meta map[string]interface{}
+	err = unmarshalMeta(format, data[b.start:b.end], &meta)
+	if err != nil {
+		return err
+	}
+
+	if len(meta) != len(keep)+len(added) {
+		return errors.New("fields are missing")
+	}
+	for key, v := range keep {
+		if !reflect.DeepEqual(meta[key], v) {
+			return fmt.Errorf("field %q changed", key)
+		}
+	}
+	for _, key := range added {
+		if _, ok := meta[key]; !ok {
+			return fmt.Errorf("field %q is missing", key)
+		}
+	}
+
+	return nil
+}
+
+// tomlTopLines returns the offsets of the lines in meta, which is
+// TOML, that don't begin inside of a multi-line array, inline table,
+// or string.
+func tomlTopLines(meta []byte) []int {
+	var lines []int
+	var depth int
+	var quote []byte
+	lineStart := true
+	for i := 0; i < len(meta); i++ {
+		if lineStart && (depth == 0) && (quote == nil) {
+			lines = append(lines, i)
+		}
+		lineStart = false
+
+		c := meta[i]
+		switch {
+		case quote != nil:
+			if (c == '\\') && (quote[0] == '"') {
+				i++
+				break
+			}
+			if bytes.HasPrefix(meta[i:], quote) {
+				i += len(quote) - 1
+				quote = nil
+			}
+
+		case c == '#':
+			for (i+1 < len(meta)) && (meta[i+1] != '\n') {
+				i++
+			}
+
+		case (c == '"') || (c == '\''):
+			quote = meta[i : i+1]
+			if triple := bytes.Repeat(quote, 3); bytes.HasPrefix(meta[i:], triple) {
+				quote = triple
+			}
+			i += len(quote) - 1
+
+		case (c == '[') || (c == '{'):
+			depth++
+
+		case (c == ']') || (c == '}'):
+			if depth > 0 {
+				depth--
+			}
+		}
+
+		if (i < len(meta)) && (meta[i] == '\n') {
+			lineStart = true
+		}
+	}
+	return lines
+}
+
+// tomlTableStart returns the offset of the first table header in
+// meta, which is TOML, or len(meta) if there isn't one.
+func tomlTableStart(meta []byte) int {
+	for _, i := range tomlTopLines(meta) {
+		if line := bytes.TrimLeft(meta[i:], " \t"); (len(line) > 0) && (line[0] == '[') {
+			return i
+		}
+	}
+	return len(meta)
+}
+
+// afterContent returns the offset of the start of the line following
+// the last line in data[start:end] that isn't blank, or end if that
+// line is the last one.
+func afterContent(data []byte, start, end int) int {
+	pos := start + len(bytes.TrimRight(data[start:end], " \t\r\n"))
+	if pos == start {
+		return start
+	}
+	if i := bytes.IndexByte(data[pos:end], '\n'); i >= 0 {
+		return pos + i + 1
+	}
+	return pos
+}
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	err := e.Encode(v)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), err
+}
+
+// jsonMember is the location of a member of a JSON object. start is
+// the offset of its key and end is the offset just after its value.
+type jsonMember struct {
+	key        string
+	start, end int
+}
+
+// jsonMembers finds the members of the JSON object in obj.
+func jsonMembers(obj []byte) ([]jsonMember, error) {
+	i := bytes.IndexByte(obj, '{') + 1
+	skipSpace := func() {
+		for (i < len(obj)) && bytes.IndexByte([]byte(" \t\r\n"), obj[i]) >= 0 {
+			i++
+		}
+	}
+
+	var members []jsonMember
+	for {
+		skipSpace()
+		if (i >= len(obj)) || (obj[i] == '}') {
+			return members, nil
+		}
+
+		start := i
+		end := skipJSONValue(obj, i)
+		var key string
+		err := json.Unmarshal(obj[start:end], &key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON metadata: %v", err)
+		}
+
+		i = end
+		skipSpace()
+		if (i >= len(obj)) || (obj[i] != ':') {
+			return nil, fmt.Errorf("invalid JSON metadata: expected ':' after %q", key)
+		}
+		i++
+		skipSpace()
+		i = skipJSONValue(obj, i)
+		members = append(members, jsonMember{key: key, start: start, end: i})
+
+		skipSpace()
+		if (i < len(obj)) && (obj[i] == ',') {
+			i++
+		}
+	}
+}
+
+// skipJSONValue returns the offset just after the JSON value that
+// starts at offset i in data.
+func skipJSONValue(data []byte, i int) int {
+	var depth int
+	for i < len(data) {
+		c := data[i]
+		switch c {
+		case '"':
+			for i++; (i < len(data)) && (data[i] != '"'); i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			i++
+
+		case '{', '[':
+			depth++
+			i++
+
+		case '}', ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+			i++
+
+		case ',', ' ', '\t', '\r', '\n', ':':
+			if depth == 0 {
+				return i
+			}
+			i++
+
+		default:
+			i++
+		}
+
+		if depth == 0 && (c == '"' || c == '}' || c == ']') {
+			return i
+		}
+	}
+	return i
+}
@@ -0,0 +1,309 @@
+package shigoto
+
+import (
+	"testing"
+)
+
+func TestSplitMeta(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format MetaFormat
+		found  bool
+		meta   string
+		rest   string
+	}{
+		{
+			name:   "YAML",
+			data:   "type: post.html\n+++++\nbody\n",
+			format: YAML,
+			found:  true,
+			meta:   "type: post.html\n",
+			rest:   "body\n",
+		},
+		{
+			name:   "YAMLLongSeparator",
+			data:   "a: 1\n++++++++++\r\nbody",
+			format: YAML,
+			found:  true,
+			meta:   "a: 1\n",
+			rest:   "body",
+		},
+		{
+			name:   "None",
+			data:   "just content\n",
+			format: YAML,
+			rest:   "just content\n",
+		},
+		{
+			name:   "TOML",
+			data:   "+++\ntype = \"post.html\"\n+++\nbody\n",
+			format: TOML,
+			found:  true,
+			meta:   "type = \"post.html\"\n",
+			rest:   "body\n",
+		},
+		{
+			name:   "JSON",
+			data:   "{\"type\": \"post.html\"}\n+++++\nbody\n",
+			format: JSON,
+			found:  true,
+			meta:   "{\"type\": \"post.html\"}",
+			rest:   "body\n",
+		},
+		{
+			name:   "JSONBody",
+			data:   "{\"items\": []}\n",
+			format: YAML,
+			rest:   "{\"items\": []}\n",
+		},
+		{
+			name:   "LiteralBrace",
+			data:   "{ is a brace\n",
+			format: YAML,
+			rest:   "{ is a brace\n",
+		},
+		{
+			name:   "JSONSeparator",
+			data:   "{\"a\": {\"b\": \"}\"}}\n+++++\nbody\n",
+			format: JSON,
+			found:  true,
+			meta:   "{\"a\": {\"b\": \"}\"}}",
+			rest:   "body\n",
+		},
+		{
+			name:   "YAMLFlowMapping",
+			data:   "{type: post.html}\n+++++\nbody\n",
+			format: YAML,
+			found:  true,
+			meta:   "{type: post.html}\n",
+			rest:   "body\n",
+		},
+		{
+			name:   "NotJSON",
+			data:   "+++++\n{\"a\": 1}\n",
+			format: YAML,
+			found:  true,
+			meta:   "",
+			rest:   "{\"a\": 1}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := splitMeta([]byte(test.data), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if b.format != test.format {
+				t.Errorf("format: expected %q, got %q", test.format, b.format)
+			}
+			if b.found != test.found {
+				t.Errorf("found: expected %v, got %v", test.found, b.found)
+			}
+			if meta := test.data[b.start:b.end]; b.found && (meta != test.meta) {
+				t.Errorf("meta: expected %q, got %q", test.meta, meta)
+			}
+			if rest := test.data[b.rem:]; rest != test.rest {
+				t.Errorf("rest: expected %q, got %q", test.rest, rest)
+			}
+		})
+	}
+}
+
+func TestSplitMetaUnterminatedTOML(t *testing.T) {
+	_, err := splitMeta([]byte("+++\na = 1\nbody\n"), "")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSplitMetaJSONWithoutSeparator(t *testing.T) {
+	_, err := splitMeta([]byte("{\"a\": 1}\nbody\n"), JSON)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+var timeField = MetaField{Key: "time", Value: "Sun, 18 Oct 2026 08:57:24 UTC"}
+
+func TestAddMeta(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		fields []MetaField
+		out    string
+		err    bool
+	}{
+		{
+			name:   "YAML",
+			data:   "# comment\ntitle: Post   # trailing\ntags:\n  - b\n  - a\n\n+++++\nbody\n",
+			fields: []MetaField{{Key: "title", Value: "Other"}, timeField},
+			out:    "# comment\ntitle: Post   # trailing\ntags:\n  - b\n  - a\ntime: Sun, 18 Oct 2026 08:57:24 UTC\n\n+++++\nbody\n",
+		},
+		{
+			name:   "YAMLTrailingComment",
+			data:   "a: 1\n# end\n\n\n+++++\nbody\n",
+			fields: []MetaField{timeField},
+			out:    "a: 1\n# end\ntime: Sun, 18 Oct 2026 08:57:24 UTC\n\n\n+++++\nbody\n",
+		},
+		{
+			name:   "YAMLPresent",
+			data:   "time: yesterday\n+++++\nbody\n",
+			fields: []MetaField{timeField},
+			out:    "time: yesterday\n+++++\nbody\n",
+		},
+		{
+			name:   "YAMLFlowMapping",
+			data:   "{type: post.html}\n+++++\nbody\n",
+			fields: []MetaField{timeField},
+			err:    true,
+		},
+		{
+			name:   "None",
+			data:   "body\n",
+			fields: []MetaField{timeField},
+			out:    "time: Sun, 18 Oct 2026 08:57:24 UTC\n\n++++++++++\nbody\n",
+		},
+		{
+			name:   "TOML",
+			data:   "+++\n# comment\ntitle = \"Post\"\n\n[nested]\nz = 1\n+++\nbody\n",
+			fields: []MetaField{timeField},
+			out:    "+++\n# comment\ntitle = \"Post\"\ntime = \"Sun, 18 Oct 2026 08:57:24 UTC\"\n\n[nested]\nz = 1\n+++\nbody\n",
+		},
+		{
+			name:   "TOMLNestedArray",
+			data:   "+++\narr = [\n  [1, 2],\n  [3, 4],\n]\n+++\nbody\n",
+			fields: []MetaField{timeField},
+			out:    "+++\narr = [\n  [1, 2],\n  [3, 4],\n]\ntime = \"Sun, 18 Oct 2026 08:57:24 UTC\"\n+++\nbody\n",
+		},
+		{
+			name:   "TOMLStringWithBracket",
+			data:   "+++\ns = \"\"\"\n[not a table]\n\"\"\"\n[table]\na = 1\n+++\nbody\n",
+			fields: []MetaField{timeField},
+			out:    "+++\ns = \"\"\"\n[not a table]\n\"\"\"\ntime = \"Sun, 18 Oct 2026 08:57:24 UTC\"\n[table]\na = 1\n+++\nbody\n",
+		},
+		{
+			name:   "JSON",
+			data:   "{\n\t\"title\": \"Post\",\n\t\"zz\": [1, 2]\n}\n+++++\nbody\n",
+			fields: []MetaField{timeField},
+			out:    "{\n\t\"title\": \"Post\",\n\t\"zz\": [1, 2],\n\t\"time\": \"Sun, 18 Oct 2026 08:57:24 UTC\"\n}\n+++++\nbody\n",
+		},
+		{
+			name:   "JSONInline",
+			data:   "{\"title\": \"<Post>\"}\n+++++\nbody\n",
+			fields: []MetaField{{Key: "type", Value: "a&b"}, timeField},
+			out:    "{\"title\": \"<Post>\", \"type\": \"a&b\", \"time\": \"Sun, 18 Oct 2026 08:57:24 UTC\"}\n+++++\nbody\n",
+		},
+		{
+			name:   "JSONEmpty",
+			data:   "{}\n+++++\nbody\n",
+			fields: []MetaField{timeField},
+			out:    "{\"time\": \"Sun, 18 Oct 2026 08:57:24 UTC\"}\n+++++\nbody\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := AddMeta([]byte(test.data), test.fields...)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(out) != test.out {
+				t.Errorf("expected\n%q\ngot\n%q", test.out, out)
+			}
+		})
+	}
+}
+
+func TestRemoveMeta(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		out  string
+		err  bool
+	}{
+		{
+			name: "YAML",
+			data: "# comment\ntime: yesterday\ntitle: Post\n+++++\nbody\n",
+			out:  "# comment\ntitle: Post\n+++++\nbody\n",
+		},
+		{
+			name: "YAMLMultiline",
+			data: "time:\n  - a\n  - b\nx: 1\n+++++\nbody\n",
+			out:  "x: 1\n+++++\nbody\n",
+		},
+		{
+			name: "YAMLUnindentedList",
+			data: "time:\n- a\n- b\nx: 1\n+++++\nbody\n",
+			out:  "x: 1\n+++++\nbody\n",
+		},
+		{
+			name: "YAMLMissing",
+			data: "x: 1\n+++++\nbody\n",
+			out:  "x: 1\n+++++\nbody\n",
+		},
+		{
+			name: "YAMLFlowMapping",
+			data: "{time: yesterday, x: 1}\n+++++\nbody\n",
+			err:  true,
+		},
+		{
+			name: "None",
+			data: "body only",
+			out:  "body only",
+		},
+		{
+			name: "TOML",
+			data: "+++\ntime = \"yesterday\"\nx = 1\n[table]\ntime = 2\n+++\nbody\n",
+			out:  "+++\nx = 1\n[table]\ntime = 2\n+++\nbody\n",
+		},
+		{
+			name: "TOMLMultiline",
+			data: "+++\ntime = [\n  [1, 2],\n]\nx = 1\n+++\nbody\n",
+			out:  "+++\nx = 1\n+++\nbody\n",
+		},
+		{
+			name: "JSONFirst",
+			data: "{\"time\": \"x\", \"a\": {\"b\": [1, \"}\"]}}\n+++++\nbody",
+			out:  "{\"a\": {\"b\": [1, \"}\"]}}\n+++++\nbody",
+		},
+		{
+			name: "JSONLast",
+			data: "{\n  \"a\": 1,\n  \"time\": \"x\"\n}\n+++++\nbody",
+			out:  "{\n  \"a\": 1\n}\n+++++\nbody",
+		},
+		{
+			name: "JSONOnly",
+			data: "{\"time\": 1}\n+++++\nbody",
+			out:  "{}\n+++++\nbody",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := RemoveMeta([]byte(test.data), "time")
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(out) != test.out {
+				t.Errorf("expected\n%q\ngot\n%q", test.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package shigoto
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// field returns the value of key for c. The names of the fields of
+// Content refer to those fields, while anything else is looked up in
+// the content's metadata.
+func (c Content) field(key string) (interface{}, bool) {
+	switch key {
+	case "Path":
+		return c.Path, true
+	case "Type":
+		return c.Type, true
+	case "Title":
+		return c.Title, true
+	case "URL":
+		return c.URL, true
+	case "Time":
+		return c.Time, !c.Time.IsZero()
+	}
+
+	v, ok := c.Meta[key]
+	return v, ok
+}
+
+func filterContent(key, check string, val interface{}, c []Content) ([]Content, error) {
+	var match func(v interface{}, ok bool) bool
+	switch check {
+	case "eq":
+		match = func(v interface{}, ok bool) bool {
+			return ok && compare(v, val) == 0
+		}
+	case "ne":
+		match = func(v interface{}, ok bool) bool {
+			return !ok || compare(v, val) != 0
+		}
+	case "lt":
+		match = func(v interface{}, ok bool) bool {
+			return ok && compare(v, val) < 0
+		}
+	case "gt":
+		match = func(v interface{}, ok bool) bool {
+			return ok && compare(v, val) > 0
+		}
+	case "in":
+		list := toList(val)
+		match = func(v interface{}, ok bool) bool {
+			return ok && contains(list, v)
+		}
+	case "contains":
+		match = func(v interface{}, ok bool) bool {
+			if !ok {
+				return false
+			}
+			if s, ok := v.(string); ok {
+				return strings.Contains(s, fmt.Sprint(val))
+			}
+			return contains(toList(v), val)
+		}
+	case "exists":
+		match = func(v interface{}, ok bool) bool {
+			return ok
+		}
+	default:
+		return nil, fmt.Errorf("unknown filter check %q", check)
+	}
+
+	var r []Content
+	for _, content := range c {
+		if match(content.field(key)) {
+			r = append(r, content)
+		}
+	}
+	return r, nil
+}
+
+func sortContent(key, order string, c []Content) ([]Content, error) {
+	var desc bool
+	switch order {
+	case "asc":
+	case "desc":
+		desc = true
+	default:
+		return nil, fmt.Errorf("unknown sort order %q", order)
+	}
+
+	r := make([]Content, len(c))
+	copy(r, c)
+	sort.SliceStable(r, func(i1, i2 int) bool {
+		v1, ok1 := r[i1].field(key)
+		v2, ok2 := r[i2].field(key)
+		if !ok1 || !ok2 {
+			// Content without the key always goes last.
+			return ok1 && !ok2
+		}
+
+		if desc {
+			return compare(v1, v2) > 0
+		}
+		return compare(v1, v2) < 0
+	})
+	return r, nil
+}
+
+func sliceContent(start, end int, c []Content) []Content {
+	if end > len(c) {
+		end = len(c)
+	}
+	if end < 0 {
+		end = 0
+	}
+	if start > end {
+		start = end
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	return c[start:end]
+}
+
+func pageSlice(pages map[string]interface{}, c []Content) ([]Content, error) {
+	start, ok := pages["PageStart"].(int)
+	if !ok {
+		return nil, fmt.Errorf("bad PageStart: %v", pages["PageStart"])
+	}
+	end, ok := pages["PageEnd"].(int)
+	if !ok {
+		return nil, fmt.Errorf("bad PageEnd: %v", pages["PageEnd"])
+	}
+
+	return sliceContent(start, end, c), nil
+}
+
+// compare compares two metadata values, returning a negative number,
+// zero, or a positive number if v1 is less than, equal to, or
+// greater than v2, respectively. Numbers and times are compared as
+// such, even if one of them is given as a string, while anything
+// else is compared by its string representation.
+func compare(v1, v2 interface{}) int {
+	if n1, ok := toFloat(v1); ok {
+		if n2, ok := toFloat(v2); ok {
+			switch {
+			case n1 < n2:
+				return -1
+			case n1 > n2:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if t1, err := ParseTime(v1); err == nil {
+		if t2, err := ParseTime(v2); err == nil {
+			switch {
+			case t1.Before(t2):
+				return -1
+			case t1.After(t2):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(v1), fmt.Sprint(v2))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+
+	return 0, false
+}
+
+// toList converts v into a list of values. Strings are split on
+// commas so that lists can be given as literals in templates.
+func toList(v interface{}) []interface{} {
+	if s, ok := v.(string); ok {
+		parts := strings.Split(s, ",")
+		list := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			list = append(list, strings.TrimSpace(part))
+		}
+		return list
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			list = append(list, rv.Index(i).Interface())
+		}
+		return list
+	}
+
+	return []interface{}{v}
+}
+
+func contains(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if compare(item, v) == 0 {
+			return true
+		}
+	}
+	return false
+}
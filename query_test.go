@@ -0,0 +1,197 @@
+package shigoto
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var queryContent = []Content{
+	{
+		Path:  "a.md",
+		Title: "A",
+		Time:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Meta:  map[string]interface{}{"n": 10, "tags": []interface{}{"go", "web"}, "author": "me"},
+	},
+	{
+		Path:  "b.md",
+		Title: "B",
+		Time:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Meta:  map[string]interface{}{"n": 2, "tags": []interface{}{"rust"}, "author": "you"},
+	},
+	{
+		Path:  "c.md",
+		Title: "C",
+		Meta:  map[string]interface{}{"n": "3.5", "author": "someone"},
+	},
+	{
+		Path:  "d.md",
+		Title: "D",
+		Meta:  map[string]interface{}{},
+	},
+}
+
+// paths returns the paths of c.
+func paths(c []Content) []string {
+	p := make([]string, 0, len(c))
+	for _, c := range c {
+		p = append(p, c.Path)
+	}
+	return p
+}
+
+func TestFilterContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		check string
+		val   interface{}
+		paths []string
+		err   bool
+	}{
+		{name: "Eq", key: "author", check: "eq", val: "me", paths: []string{"a.md"}},
+		{name: "EqNumber", key: "n", check: "eq", val: "10", paths: []string{"a.md"}},
+		{name: "Ne", key: "author", check: "ne", val: "me", paths: []string{"b.md", "c.md", "d.md"}},
+		{name: "Lt", key: "n", check: "lt", val: 4, paths: []string{"b.md", "c.md"}},
+		{name: "Gt", key: "n", check: "gt", val: 2, paths: []string{"a.md", "c.md"}},
+		{name: "GtTime", key: "Time", check: "gt", val: "2020-01-01T12:00:00Z", paths: []string{"a.md"}},
+		{name: "In", key: "Title", check: "in", val: "A, C", paths: []string{"a.md", "c.md"}},
+		{name: "InList", key: "n", check: "in", val: []interface{}{2, 3.5}, paths: []string{"b.md", "c.md"}},
+		{name: "ContainsList", key: "tags", check: "contains", val: "go", paths: []string{"a.md"}},
+		{name: "ContainsString", key: "author", check: "contains", val: "o", paths: []string{"b.md", "c.md"}},
+		{name: "Exists", key: "tags", check: "exists", paths: []string{"a.md", "b.md"}},
+		{name: "ExistsTime", key: "Time", check: "exists", paths: []string{"a.md", "b.md"}},
+		{name: "Unknown", key: "n", check: "le", val: 1, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := filterContent(test.key, test.check, test.val, queryContent)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", paths(r))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p := paths(r); !reflect.DeepEqual(p, test.paths) {
+				t.Errorf("expected %v, got %v", test.paths, p)
+			}
+		})
+	}
+}
+
+func TestSortContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		order string
+		paths []string
+		err   bool
+	}{
+		{name: "Asc", key: "n", order: "asc", paths: []string{"b.md", "c.md", "a.md", "d.md"}},
+		{name: "Desc", key: "n", order: "desc", paths: []string{"a.md", "c.md", "b.md", "d.md"}},
+		{name: "Time", key: "Time", order: "asc", paths: []string{"b.md", "a.md", "c.md", "d.md"}},
+		{name: "Stable", key: "missing", order: "desc", paths: []string{"a.md", "b.md", "c.md", "d.md"}},
+		{name: "Unknown", key: "n", order: "up", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := sortContent(test.key, test.order, queryContent)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", paths(r))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p := paths(r); !reflect.DeepEqual(p, test.paths) {
+				t.Errorf("expected %v, got %v", test.paths, p)
+			}
+		})
+	}
+
+	if p := paths(queryContent); !reflect.DeepEqual(p, []string{"a.md", "b.md", "c.md", "d.md"}) {
+		t.Errorf("sort modified its input: %v", p)
+	}
+}
+
+func TestSliceContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		paths      []string
+	}{
+		{name: "Middle", start: 1, end: 3, paths: []string{"b.md", "c.md"}},
+		{name: "PastEnd", start: 2, end: 10, paths: []string{"c.md", "d.md"}},
+		{name: "StartPastEnd", start: 10, end: 12, paths: []string{}},
+		{name: "Reversed", start: 3, end: 1, paths: []string{}},
+		{name: "NegativeStart", start: -2, end: 1, paths: []string{"a.md"}},
+		{name: "NegativeEnd", start: 0, end: -1, paths: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := sliceContent(test.start, test.end, queryContent)
+			if p := paths(r); !reflect.DeepEqual(p, test.paths) {
+				t.Errorf("expected %v, got %v", test.paths, p)
+			}
+		})
+	}
+}
+
+func TestPageSlice(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages map[string]interface{}
+		paths []string
+		err   bool
+	}{
+		{
+			name:  "FirstPage",
+			pages: PagesInfo{Per: 3}.PageMap(1, len(queryContent)),
+			paths: []string{"a.md", "b.md", "c.md"},
+		},
+		{
+			name:  "LastPage",
+			pages: PagesInfo{Per: 3}.PageMap(2, len(queryContent)),
+			paths: []string{"d.md"},
+		},
+		{
+			name:  "BadStart",
+			pages: map[string]interface{}{"PageStart": "0", "PageEnd": 1},
+			err:   true,
+		},
+		{
+			name:  "MissingEnd",
+			pages: map[string]interface{}{"PageStart": 0},
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := pageSlice(test.pages, queryContent)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", paths(r))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p := paths(r); !reflect.DeepEqual(p, test.paths) {
+				t.Errorf("expected %v, got %v", test.paths, p)
+			}
+		})
+	}
+}
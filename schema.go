@@ -0,0 +1,256 @@
+package shigoto
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Schema describes the metadata that content of a given type is
+// expected to have. It is parsed from the schema metadata field of a
+// template.
+type Schema map[string]SchemaField
+
+// SchemaField describes a single field in a Schema.
+type SchemaField struct {
+	// Type is the type that the field's value must have. It is one of
+	// "string", "int", "float", "bool", "time", "list", or "object". If
+	// it is empty, the value may be of any type.
+	Type string
+
+	// Required is true if content must have the field.
+	Required bool
+
+	// Enum, if it isn't empty, lists every value that the field may
+	// have. If the field is a list, every element of it must be one of
+	// them.
+	Enum []interface{}
+
+	// Default is the value that is given to the field if the content
+	// doesn't have it. It is nil if the field has no default.
+	Default interface{}
+}
+
+var schemaTypes = map[string]bool{
+	"":       true,
+	"string": true,
+	"int":    true,
+	"float":  true,
+	"bool":   true,
+	"time":   true,
+	"list":   true,
+	"object": true,
+}
+
+// ParseSchema parses the raw value of a schema metadata field. Each
+// key in raw is the name of a field, and its value is either the name
+// of the field's type or an object with type, required, enum, and
+// default fields. A nil raw results in a nil Schema.
+func ParseSchema(raw interface{}) (Schema, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	rawmap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("schema is not an object")
+	}
+
+	s := make(Schema, len(rawmap))
+	for _, key := range sortedKeys(rawmap) {
+		field, err := parseSchemaField(rawmap[key])
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", key, err)
+		}
+		s[key] = field
+	}
+
+	return s, nil
+}
+
+func parseSchemaField(raw interface{}) (SchemaField, error) {
+	var field SchemaField
+	switch raw := raw.(type) {
+	case string:
+		field.Type = raw
+
+	case map[string]interface{}:
+		for key, v := range raw {
+			var ok bool
+			switch key {
+			case "type":
+				field.Type, ok = v.(string)
+			case "required":
+				field.Required, ok = v.(bool)
+			case "enum":
+				field.Enum, ok = v.([]interface{})
+			case "default":
+				field.Default, ok = v, true
+			default:
+				return field, fmt.Errorf("unknown key %q", key)
+			}
+			if !ok {
+				return field, fmt.Errorf("%v has the wrong type", key)
+			}
+		}
+
+	default:
+		return field, errors.New("not a type or an object")
+	}
+
+	if !schemaTypes[field.Type] {
+		return field, fmt.Errorf("unknown type %q", field.Type)
+	}
+
+	if field.Default != nil {
+		err := field.check(field.Default)
+		if err != nil {
+			return field, fmt.Errorf("invalid default: %v", err)
+		}
+	}
+
+	return field, nil
+}
+
+// check returns an error if v isn't a valid value for f.
+func (f SchemaField) check(v interface{}) error {
+	var ok bool
+	switch f.Type {
+	case "":
+		ok = true
+	case "string":
+		_, ok = v.(string)
+	case "int":
+		_, ok = v.(int)
+	case "float":
+		switch v.(type) {
+		case int, float64:
+			ok = true
+		}
+	case "bool":
+		_, ok = v.(bool)
+	case "time":
+		_, err := ParseTime(v)
+		ok = err == nil
+	case "list":
+		_, ok = v.([]interface{})
+	case "object":
+		_, ok = v.(map[string]interface{})
+	}
+	if !ok {
+		return fmt.Errorf("%v is not a %v", metaTypeName(v), f.Type)
+	}
+
+	if len(f.Enum) == 0 {
+		return nil
+	}
+
+	vals := []interface{}{v}
+	if list, ok := v.([]interface{}); ok && (f.Type == "list") {
+		vals = list
+	}
+	for _, v := range vals {
+		if !f.allows(v) {
+			return fmt.Errorf("%#v is not one of %v", v, f.Enum)
+		}
+	}
+
+	return nil
+}
+
+// allows returns true if v is one of the values in f.Enum.
+func (f SchemaField) allows(v interface{}) bool {
+	for _, e := range f.Enum {
+		if reflect.DeepEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// metaTypeName returns the name of the type of a metadata value, as
+// used in a Schema.
+func metaTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Apply checks meta against s, returning an error for each problem
+// with it. Fields that are missing from meta and that have a default
+// value are set to a copy of it.
+func (s Schema) Apply(meta map[string]interface{}) []error {
+	var errs []error
+	for _, key := range sortedKeys(s) {
+		field := s[key]
+
+		v, ok := meta[key]
+		if !ok {
+			switch {
+			case field.Default != nil:
+				meta[key] = copyValue(field.Default)
+			case field.Required:
+				errs = append(errs, fmt.Errorf("missing required field %q", key))
+			}
+			continue
+		}
+
+		err := field.check(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %v: %v", key, err))
+		}
+	}
+
+	return errs
+}
+
+// copyValue returns a deep copy of v, a metadata value, so that
+// changing the copy doesn't affect anything else that uses v.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, v := range v {
+			c[key] = copyValue(v)
+		}
+		return c
+
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, v := range v {
+			c[i] = copyValue(v)
+		}
+		return c
+
+	default:
+		return v
+	}
+}
+
+// sortedKeys returns the keys of m, which must be a map with string
+// keys, in sorted order.
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	s := make([]string, 0, len(keys))
+	for _, key := range keys {
+		s = append(s, key.String())
+	}
+	sort.Strings(s)
+	return s
+}
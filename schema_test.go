@@ -0,0 +1,84 @@
+package shigoto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaApply(t *testing.T) {
+	s, err := ParseSchema(map[string]interface{}{
+		"author":   map[string]interface{}{"type": "string", "required": true},
+		"category": map[string]interface{}{"enum": []interface{}{"news", "tech"}, "default": "news"},
+		"tags":     map[string]interface{}{"type": "list", "default": []interface{}{"misc"}},
+		"extra":    map[string]interface{}{"type": "object", "default": map[string]interface{}{"a": []interface{}{1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		meta map[string]interface{}
+		out  map[string]interface{}
+		errs int
+	}{
+		{
+			name: "Defaults",
+			meta: map[string]interface{}{"author": "me"},
+			out: map[string]interface{}{
+				"author":   "me",
+				"category": "news",
+				"tags":     []interface{}{"misc"},
+				"extra":    map[string]interface{}{"a": []interface{}{1}},
+			},
+		},
+		{
+			name: "Invalid",
+			meta: map[string]interface{}{"category": "food", "tags": "a", "extra": map[string]interface{}{}},
+			out:  map[string]interface{}{"category": "food", "tags": "a", "extra": map[string]interface{}{}},
+			errs: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := s.Apply(test.meta)
+			if len(errs) != test.errs {
+				t.Errorf("expected %v errors, got %v", test.errs, errs)
+			}
+			if !reflect.DeepEqual(test.meta, test.out) {
+				t.Errorf("expected %v, got %v", test.out, test.meta)
+			}
+		})
+	}
+}
+
+func TestSchemaApplyCopiesDefaults(t *testing.T) {
+	s, err := ParseSchema(map[string]interface{}{
+		"tags":  map[string]interface{}{"default": []interface{}{"misc"}},
+		"extra": map[string]interface{}{"default": map[string]interface{}{"a": []interface{}{1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m1 := make(map[string]interface{})
+	m2 := make(map[string]interface{})
+	s.Apply(m1)
+	s.Apply(m2)
+
+	m1["tags"].([]interface{})[0] = "changed"
+	m1["extra"].(map[string]interface{})["a"].([]interface{})[0] = 2
+	m1["extra"].(map[string]interface{})["b"] = true
+
+	expected := map[string]interface{}{
+		"tags":  []interface{}{"misc"},
+		"extra": map[string]interface{}{"a": []interface{}{1}},
+	}
+	if !reflect.DeepEqual(m2, expected) {
+		t.Errorf("changing one copy changed another: %v", m2)
+	}
+	if !reflect.DeepEqual(s["tags"].Default, expected["tags"]) || !reflect.DeepEqual(s["extra"].Default, expected["extra"]) {
+		t.Errorf("changing a copy changed the defaults: %v", s)
+	}
+}
@@ -0,0 +1,574 @@
+package shigoto
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DeedleFake/shigoto/internal/common"
+)
+
+// A Site is a project that has been loaded for building. Content is
+// loaded from the publish directory the first time that it is needed
+// and is then cached for the lifetime of the Site.
+type Site struct {
+	Root string
+	Tmpl map[string]Tmpl
+
+	// Data is the data loaded from the files in the data directory.
+	Data map[string]interface{}
+
+	// Drafts, if true, causes drafts to be loaded along with published
+	// content as if they had been published. It must be set before the
+	// content is first loaded.
+	Drafts bool
+
+	// Future and Expired, if true, cause content with a time in the
+	// future or an expiry time in the past, respectively, to be loaded
+	// instead of skipped. Both are relative to Now, or to the current
+	// time if Now is the zero time. Like Drafts, they must be set
+	// before the content is first loaded.
+	Future  bool
+	Expired bool
+	Now     time.Time
+
+	content struct {
+		common.Once
+		c []Content
+	}
+}
+
+// LoadSite loads the templates and data of the project rooted at root.
+func LoadSite(root string) (*Site, error) {
+	site, errs := CheckSite(root)
+	if len(errs) != 0 {
+		return nil, errs[0]
+	}
+
+	return site, nil
+}
+
+// CheckSite loads the site in the same way as LoadSite, but, rather
+// than stopping at the first template or data file that fails to
+// load, it skips them and returns every error that occurred along with
+// the rest of the site. Templates whose inherit chains are broken or form
+// cycles are kept, but are reported as errors.
+func CheckSite(root string) (*Site, []error) {
+	site := &Site{Root: root}
+
+	tmpl, errs := loadTmpl(filepath.Join(root, "tmpl"), SiteFuncs(site))
+	site.Tmpl = tmpl
+
+	data, dataErrs := loadData(filepath.Join(root, "data"))
+	site.Data = data
+	errs = append(errs, dataErrs...)
+
+	names := make([]string, 0, len(tmpl))
+	for name := range tmpl {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Every template in a cycle, as well as every template that
+	// inherits from one in a cycle, reports the same error, so only
+	// the first of each is kept.
+	seen := make(map[string]bool)
+	for _, name := range names {
+		_, err := site.Inherits(name)
+		if (err != nil) && !seen[err.Error()] {
+			seen[err.Error()] = true
+			errs = append(errs, err)
+		}
+	}
+
+	return site, errs
+}
+
+// Inherits returns the chain of templates that the named template
+// inherits from, starting with the named template itself. It returns
+// an error if the chain refers to a template that doesn't exist or if
+// it loops back on itself.
+func (site *Site) Inherits(name string) ([]string, error) {
+	chain := []string{name}
+	seen := map[string]int{name: 0}
+	for {
+		t, ok := site.Tmpl[name]
+		if !ok {
+			if len(chain) == 1 {
+				return nil, fmt.Errorf("unknown template %q", name)
+			}
+			return nil, fmt.Errorf("%v: unknown template %q", strings.Join(chain[:len(chain)-1], " -> "), name)
+		}
+
+		inherit, ok := t.Meta["inherit"]
+		if !ok {
+			return chain, nil
+		}
+		name, ok = inherit.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v: inherit is not a string", strings.Join(chain, " -> "))
+		}
+
+		if i, ok := seen[name]; ok {
+			// Start the cycle at the same place no matter where it was
+			// entered from.
+			cycle := chain[i:]
+			var first int
+			for i := range cycle {
+				if cycle[i] < cycle[first] {
+					first = i
+				}
+			}
+			cycle = append(cycle[first:], cycle[:first]...)
+
+			return nil, fmt.Errorf("inheritance cycle: %v -> %v", strings.Join(cycle, " -> "), cycle[0])
+		}
+		seen[name] = len(chain)
+		chain = append(chain, name)
+	}
+}
+
+// Content is a single piece of published content.
+type Content struct {
+	// Path is the path to the content's file relative to the publish
+	// directory.
+	Path string
+
+	Type  string
+	Title string
+	Meta  map[string]interface{}
+
+	// MetaFormat is the format that the content's metadata was
+	// written in.
+	MetaFormat MetaFormat
+
+	// Body is the unrendered content of the file.
+	Body string
+
+	// URL is the root-relative URL of the content's output. If the
+	// content is split into pages, this is the URL of the first page.
+	URL string
+
+	// Time is the time at which the content was published, or the
+	// zero time if it has no valid time metadata.
+	Time time.Time
+
+	// Expires is the time from the content's "expires" metadata field,
+	// or the zero time if it has none.
+	Expires time.Time
+
+	// Draft is true if the content is a draft rather than published
+	// content. In that case, Path is relative to the draft directory
+	// instead.
+	Draft bool
+
+	// Resources are the other files that are bundled with the content,
+	// sorted by name.
+	Resources []Resource
+}
+
+// SourcePath returns the path to the content's file relative to the
+// project root.
+func (c Content) SourcePath() string {
+	if c.Draft {
+		return filepath.Join("draft", c.Path)
+	}
+	return filepath.Join("publish", c.Path)
+}
+
+// Scheduled returns true if c's time is after now.
+func (c Content) Scheduled(now time.Time) bool {
+	return c.Time.After(now)
+}
+
+// Expired returns true if c has an expiry time that is not after now.
+func (c Content) Expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// Content returns all of the site's published content, sorted by
+// path, along with its drafts if Drafts is true. Content that is
+// scheduled for the future or that has expired is left out unless
+// Future or Expired, respectively, are true.
+func (site *Site) Content() ([]Content, error) {
+	err := site.content.Do(func() error {
+		c, err := site.loadContent()
+		if err != nil {
+			return err
+		}
+
+		site.content.c = c
+		return nil
+	})
+	return site.content.c, err
+}
+
+// ByType returns all of the site's published content with the given
+// type.
+func (site *Site) ByType(name string) ([]Content, error) {
+	all, err := site.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	var c []Content
+	for _, content := range all {
+		if content.Type == name {
+			c = append(c, content)
+		}
+	}
+
+	return c, nil
+}
+
+func (site *Site) loadContent() ([]Content, error) {
+	content, err := readContent(filepath.Join(site.Root, "publish"), false)
+	if err != nil {
+		return nil, err
+	}
+
+	if site.Drafts {
+		drafts, err := readContent(filepath.Join(site.Root, "draft"), true)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, drafts...)
+	}
+
+	for i := range content {
+		errs := site.ApplySchema(&content[i])
+		if len(errs) != 0 {
+			return nil, fmt.Errorf("invalid metadata in %q: %v", content[i].Path, errs[0])
+		}
+	}
+
+	now := site.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	live := content[:0]
+	for _, c := range content {
+		if !site.Future && c.Scheduled(now) {
+			continue
+		}
+		if !site.Expired && c.Expired(now) {
+			continue
+		}
+		live = append(live, c)
+	}
+	content = live
+
+	sort.SliceStable(content, func(i1, i2 int) bool {
+		return content[i1].Path < content[i2].Path
+	})
+
+	counts := make(map[string]int)
+	for _, c := range content {
+		counts[c.Type]++
+	}
+
+	for i := range content {
+		c := &content[i]
+
+		t, ok := site.Tmpl[c.Type]
+		if !ok {
+			continue
+		}
+
+		pages, err := pagesInfo(*c, t)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := site.BuildPath(*c, pages.PageMap(1, counts[pages.Tmpl]))
+		if err != nil {
+			return nil, err
+		}
+		c.URL = PathURL(p)
+
+		for i := range c.Resources {
+			r := &c.Resources[i]
+			r.Output = filepath.Join(filepath.Dir(p), filepath.FromSlash(r.Name))
+			r.URL = PathURL(r.Output)
+		}
+	}
+
+	return content, nil
+}
+
+// ParseContent parses the body of c as a template. The body is parsed
+// using html/template if the template of c's type is, as the body ends
+// up in that template's HTML output, or if c has a true html metadata
+// field.
+func (site *Site) ParseContent(c Content) (Tmpl, error) {
+	html, _ := c.Meta["html"].(bool)
+	if t, ok := site.Tmpl[c.Type]; ok && t.HTML {
+		html = true
+	}
+	return parseTmpl(c.Path, c.Body, c.Meta, html, SiteFuncs(site))
+}
+
+// readContent reads all of the content files in dir along with their
+// resources.
+func readContent(dir string, draft bool) ([]Content, error) {
+	content, assets, err := scanContent(dir, draft)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(content))
+	for _, c := range content {
+		paths = append(paths, c.Path)
+	}
+	bundles, orphans := FindBundles(paths, assets)
+	if len(orphans) != 0 {
+		return nil, fmt.Errorf("%q is not content and is not in a page bundle", orphans[0])
+	}
+
+	for i := range content {
+		content[i].Resources = resources(content[i].Path, bundles[content[i].Path], draft)
+	}
+
+	return content, nil
+}
+
+// ReadContent reads the content file at path p relative to dir, which
+// should be either the publish or the draft directory of a project.
+// Files with an md, markdown, html, or htm extension are always
+// content. Other files are only content if they have metadata that
+// can be read and that has a type. If a file isn't content,
+// ErrNotContent is returned. The content's Resources are not read.
+func ReadContent(dir, p string, draft bool) (Content, error) {
+	f, err := os.Open(filepath.Join(dir, p))
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to open %q: %v", p, err)
+	}
+	defer f.Close()
+
+	c := Content{
+		Path:  p,
+		Meta:  make(map[string]interface{}),
+		Draft: draft,
+	}
+	format, rem, err := ReadMetaFormat(f, "", &c.Meta)
+	if err != nil {
+		if !isContentExt(p) {
+			return Content{}, ErrNotContent
+		}
+		return Content{}, fmt.Errorf("failed to read metadata from %q: %v", p, err)
+	}
+	c.Type, _ = c.Meta["type"].(string)
+	if (c.Type == "") && !isContentExt(p) {
+		return Content{}, ErrNotContent
+	}
+
+	body, err := ioutil.ReadAll(rem)
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to read %q: %v", p, err)
+	}
+	c.Body = string(body)
+	c.MetaFormat = format
+	c.setFields()
+
+	return c, nil
+}
+
+// setFields sets the fields of c that come from its metadata, other
+// than its type.
+func (c *Content) setFields() {
+	c.Title, _ = c.Meta["title"].(string)
+	if t, ok := c.Meta["time"]; ok {
+		c.Time, _ = ParseTime(t)
+	}
+	if t, ok := c.Meta["expires"]; ok {
+		c.Expires, _ = ParseTime(t)
+	}
+}
+
+// ApplySchema checks c's metadata against the schema of its type,
+// filling in any missing fields that have defaults, and returns an
+// error for each problem that it finds. Content with an unknown type
+// is left alone.
+func (site *Site) ApplySchema(c *Content) []error {
+	t, ok := site.Tmpl[c.Type]
+	if !ok {
+		return nil
+	}
+
+	errs := t.Schema.Apply(c.Meta)
+	c.setFields()
+	return errs
+}
+
+// BuildPath returns the path, relative to the output directory, that
+// the given page of c is written to.
+func (site *Site) BuildPath(c Content, pages map[string]interface{}) (string, error) {
+	t, ok := site.Tmpl[c.Type]
+	if !ok {
+		return "", fmt.Errorf("unknown type %q in %q", c.Type, c.Path)
+	}
+
+	buildPath, ok := TmplGet("buildPath", c.Meta, t.Meta).(string)
+	if !ok {
+		return "", fmt.Errorf("buildPath is not a string in %q", c.Path)
+	}
+
+	p, err := MetaTmpl(buildPath, map[string]interface{}{
+		"Type":  c.Type,
+		"Title": c.Title,
+		"Tmpl":  t.Meta,
+		"Meta":  c.Meta,
+		"Pages": pages,
+		"Data":  site.Data,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to construct buildPath for %q: %v", c.Path, err)
+	}
+
+	p, err = CleanPath(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid buildPath for %q: %v", c.Path, err)
+	}
+
+	return p, nil
+}
+
+// Pages returns the pagination information for c along with the
+// number of items that are being split into pages.
+func (site *Site) Pages(c Content) (PagesInfo, int, error) {
+	t, ok := site.Tmpl[c.Type]
+	if !ok {
+		return PagesInfo{}, 0, fmt.Errorf("unknown type %q in %q", c.Type, c.Path)
+	}
+
+	pages, err := pagesInfo(c, t)
+	if err != nil {
+		return PagesInfo{}, 0, err
+	}
+
+	if pages.Tmpl == "" {
+		return pages, 0, nil
+	}
+
+	of, err := site.ByType(pages.Tmpl)
+	if err != nil {
+		return pages, 0, fmt.Errorf("failed to get number of pages for %q: %v", pages.Tmpl, err)
+	}
+
+	return pages, len(of), nil
+}
+
+// pagesInfo returns the pages field of c, which is of type t.
+func pagesInfo(c Content, t Tmpl) (PagesInfo, error) {
+	pages, ok := TmplGet("pages", c.Meta, t.Meta).(PagesInfo)
+	if !ok {
+		return PagesInfo{}, fmt.Errorf("pages is not an object in %q", c.Path)
+	}
+	if pages.Per <= 0 {
+		return PagesInfo{}, fmt.Errorf("pages has a non-positive per in %q", c.Path)
+	}
+
+	return pages, nil
+}
+
+// OutputPaths returns the paths, relative to the output directory, of
+// every file that c is built into, in order of page.
+func (site *Site) OutputPaths(c Content) ([]string, error) {
+	t, ok := site.Tmpl[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q in %q", c.Type, c.Path)
+	}
+
+	feed, ok := TmplGet("feed", c.Meta, t.Meta).(FeedInfo)
+	if !ok {
+		return nil, fmt.Errorf("feed is not an object in %q", c.Path)
+	}
+	if feed.Tmpl != "" {
+		p, err := site.BuildPath(c, PagesInfo{Per: 1}.PageMap(1, 0))
+		if err != nil {
+			return nil, err
+		}
+		return []string{p}, nil
+	}
+
+	pages, num, err := site.Pages(c)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, pages.NumPages(num))
+	for current := 1; current <= pages.NumPages(num); current++ {
+		p, err := site.BuildPath(c, pages.PageMap(current, num))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+
+	return paths, nil
+}
+
+// reservedNames are names that may not be used for any element of a
+// generated path. Windows device names are reserved regardless of
+// extension.
+var reservedNames = map[string]bool{
+	".git": true,
+
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// CleanPath validates a slash-separated path generated from a
+// template, such as a buildPath or a sourceName, that is supposed to
+// be relative to some directory, returning it cleaned and converted
+// to the native format. An error is returned if the path is absolute,
+// if it refers to a directory, if it contains a reserved name, such
+// as .git, or if it would escape the directory that it is relative
+// to.
+func CleanPath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path is empty")
+	}
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") || filepath.IsAbs(p) || (filepath.VolumeName(p) != "") {
+		return "", fmt.Errorf("%q is absolute", p)
+	}
+	if strings.HasSuffix(p, "/") {
+		return "", fmt.Errorf("%q is a directory", p)
+	}
+
+	clean := path.Clean(strings.Replace(p, "\\", "/", -1))
+	if (clean == ".") || (clean == "..") || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%q is outside of its directory", p)
+	}
+
+	for _, elem := range strings.Split(clean, "/") {
+		name := strings.ToLower(elem)
+		if reservedNames[name] || reservedNames[strings.TrimSuffix(name, path.Ext(name))] {
+			return "", fmt.Errorf("%q contains reserved name %q", p, elem)
+		}
+	}
+
+	return filepath.FromSlash(clean), nil
+}
+
+// PathURL converts a path relative to the output directory into a
+// root-relative URL, dropping a trailing index.html.
+func PathURL(p string) string {
+	u := path.Join("/", filepath.ToSlash(p))
+	switch path.Base(u) {
+	case "index.html", "index.htm":
+		return strings.TrimSuffix(path.Dir(u), "/") + "/"
+	}
+
+	return u
+}
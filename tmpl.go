@@ -3,50 +3,44 @@ package shigoto
 import (
 	"errors"
 	"fmt"
+	htmltemplate "html/template"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"text/template"
+	"text/template/parse"
 	"time"
-	"unsafe"
 
 	"github.com/DeedleFake/shigoto/internal/common"
 	"github.com/gosimple/slug"
 	"github.com/russross/blackfriday/v2"
 )
 
-func StandardFuncs(tmpls map[string]Tmpl) template.FuncMap {
+// SiteFuncs returns the functions that are available to templates
+// that belong to site. site may be nil, in which case the functions
+// that need it return errors.
+func SiteFuncs(site *Site) template.FuncMap {
 	return template.FuncMap{
-		"markdown": func(str string) string {
-			out := blackfriday.Run([]byte(str))
-			return *(*string)(unsafe.Pointer(&out))
-		},
-
-		"slug": slug.Make,
-
-		"time": func(t interface{}) (time.Time, error) {
-			switch t := t.(type) {
-			case int:
-				return time.Unix(int64(t), 0), nil
-
+		"markdown": func(str interface{}) (htmltemplate.HTML, error) {
+			var in string
+			switch str := str.(type) {
 			case string:
-				for _, f := range []string{time.ANSIC, time.UnixDate, time.RubyDate, time.RFC822, time.RFC822Z, time.RFC850, time.RFC1123, time.RFC1123Z, time.RFC3339, time.RFC3339Nano, time.Stamp, time.StampMilli, time.StampMicro, time.StampNano} {
-					t, err := time.Parse(f, t)
-					if err != nil {
-						continue
-					}
-
-					return t, nil
-				}
-
-				return time.Time{}, errors.New("failed to parse time")
-
+				in = str
+			case htmltemplate.HTML:
+				in = markdownEntities.Replace(string(str))
 			default:
-				return time.Time{}, fmt.Errorf("unexpected time type: %T", t)
+				return "", fmt.Errorf("can't render %v as markdown", metaTypeName(str))
 			}
+
+			out := blackfriday.Run([]byte(in))
+			return htmltemplate.HTML(out), nil
 		},
 
+		"slug": slug.Make,
+
+		"time": ParseTime,
+
 		"trimExt": func(file string) string {
 			return strings.TrimSuffix(file, filepath.Ext(file))
 		},
@@ -55,68 +49,461 @@ func StandardFuncs(tmpls map[string]Tmpl) template.FuncMap {
 			return strings.TrimPrefix(filepath.Ext(file), ".")
 		},
 
-		"tmpl": func(name string, data interface{}) (string, error) {
-			if tmpls == nil {
+		"tmpl": func(name string, data interface{}) (interface{}, error) {
+			if site == nil {
 				return "", errors.New("tmpl is unavailable in this context")
 			}
 
-			t, ok := tmpls[name]
+			t, ok := site.Tmpl[name]
 			if !ok {
 				return "", fmt.Errorf("unknown tmpl %q", name)
 			}
 
 			var out strings.Builder
 			err := t.Tmpl.Execute(&out, data)
+			if t.HTML {
+				// The output of an HTML template is already escaped.
+				return htmltemplate.HTML(out.String()), err
+			}
 			return out.String(), err
 		},
 
-		// TODO: getByType(name string) ([]Content, error)
-		// TODO: filter(k, check, val string, c []Content) []Content
-		// TODO: slice(start, end int, c []Content) []Content
-		// TODO: pageSlice(start, end int, c []Content) []Content
+		"getByType": func(name string) ([]Content, error) {
+			if site == nil {
+				return nil, errors.New("getByType is unavailable in this context")
+			}
+
+			return site.ByType(name)
+		},
+
+		"resource": resourceURL,
+
+		"filter":    filterContent,
+		"sort":      sortContent,
+		"slice":     sliceContent,
+		"pageSlice": pageSlice,
 	}
 }
 
+// StandardFuncs returns the same functions as SiteFuncs, but with tmpl
+// looking up templates in tmpls and with getByType always returning an
+// error.
+//
+// Deprecated: Use SiteFuncs instead.
+func StandardFuncs(tmpls map[string]Tmpl) template.FuncMap {
+	if tmpls == nil {
+		return SiteFuncs(nil)
+	}
+
+	funcs := SiteFuncs(&Site{Tmpl: tmpls})
+	funcs["getByType"] = func(name string) ([]Content, error) {
+		return nil, errors.New("getByType is unavailable in this context")
+	}
+	return funcs
+}
+
+// markdownEntities replaces the numeric character references that
+// html/template escapes some characters with by named ones, as the
+// Markdown engine only recognizes the latter and would otherwise
+// escape them again.
+var markdownEntities = strings.NewReplacer(
+	"&#34;", "&quot;",
+	"&#39;", "&apos;",
+	"&#43;", "&plus;",
+)
+
+func ParseTime(t interface{}) (time.Time, error) {
+	switch t := t.(type) {
+	case time.Time:
+		return t, nil
+
+	case int:
+		return time.Unix(int64(t), 0), nil
+
+	case string:
+		for _, f := range []string{time.ANSIC, time.UnixDate, time.RubyDate, time.RFC822, time.RFC822Z, time.RFC850, time.RFC1123, time.RFC1123Z, time.RFC3339, time.RFC3339Nano, time.Stamp, time.StampMilli, time.StampMicro, time.StampNano} {
+			t, err := time.Parse(f, t)
+			if err != nil {
+				continue
+			}
+
+			return t, nil
+		}
+
+		return time.Time{}, errors.New("failed to parse time")
+
+	default:
+		return time.Time{}, fmt.Errorf("unexpected time type: %T", t)
+	}
+}
+
+// Template is a parsed template, either from text/template or from
+// html/template.
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
 type Tmpl struct {
 	Meta map[string]interface{}
-	Tmpl *template.Template
+	Tmpl Template
+
+	// HTML is true if Tmpl is from html/template, and thus escapes data
+	// contextually.
+	HTML bool
+
+	// Schema is the parsed schema field of Meta, which content of the
+	// template's type is checked against.
+	Schema Schema
+
+	tmpls, types []string
+	data         bool
+}
+
+// Calls returns the names of the templates and types that the
+// template passes to the tmpl and getByType functions. See Calls for
+// more details.
+func (t Tmpl) Calls() (tmpls, types []string) {
+	return t.tmpls, t.types
+}
+
+// UsesData returns true if the template refers to the Data field of
+// its data, and so might need to be executed again if the data
+// changes.
+func (t Tmpl) UsesData() bool {
+	return t.data
+}
+
+// isHTML determines whether the template at path should be parsed
+// using html/template. Templates with an html or htm extension are by
+// default, but the html metadata field can override that.
+func isHTML(path string, meta map[string]interface{}) bool {
+	if html, ok := meta["html"].(bool); ok {
+		return html
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseTmpl parses src as a template named name, using html/template
+// if html is true.
+func parseTmpl(name, src string, meta map[string]interface{}, html bool, funcs template.FuncMap) (Tmpl, error) {
+	t := Tmpl{
+		Meta: meta,
+		HTML: html,
+	}
+
+	var trees []*parse.Tree
+	if html {
+		ht, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs)).Parse(src)
+		if err != nil {
+			return t, fmt.Errorf("failed to parse %q: %v", name, err)
+		}
+		for _, t := range ht.Templates() {
+			trees = append(trees, t.Tree)
+		}
+		t.Tmpl = ht
+	} else {
+		tt, err := template.New(name).Funcs(funcs).Parse(src)
+		if err != nil {
+			return t, fmt.Errorf("failed to parse %q: %v", name, err)
+		}
+		for _, t := range tt.Templates() {
+			trees = append(trees, t.Tree)
+		}
+		t.Tmpl = tt
+	}
+	t.tmpls, t.types = Calls(trees...)
+	t.data = usesData(trees...)
+
+	return t, nil
 }
 
+// LoadTmpl loads every template in root, stopping at the first one
+// that fails to load. The templates are given the functions returned
+// by StandardFuncs.
+//
+// Deprecated: Use LoadSite, which gives the templates access to the
+// rest of the site, instead.
 func LoadTmpl(root string) (map[string]Tmpl, error) {
 	tmpls := make(map[string]Tmpl)
+	loaded, errs := loadTmpl(root, StandardFuncs(tmpls))
+	if len(errs) != 0 {
+		return nil, errs[0]
+	}
+
+	for name, t := range loaded {
+		tmpls[name] = t
+	}
+	return tmpls, nil
+}
+
+// loadTmpl loads every template in root. Templates that fail to load
+// are skipped, and the errors that occurred are returned along with
+// the rest of them.
+func loadTmpl(root string, funcs template.FuncMap) (map[string]Tmpl, []error) {
+	tmpls := make(map[string]Tmpl)
+	var errs []error
 	err := common.Walk(root, func(path string, fi os.FileInfo) error {
 		if fi.IsDir() {
 			return nil
 		}
 
-		f, err := os.Open(filepath.Join(root, path))
+		t, err := readTmpl(root, path, funcs)
 		if err != nil {
-			return fmt.Errorf("failed to open %q: %v", path, err)
+			errs = append(errs, err)
+			return nil
 		}
-		defer f.Close()
 
-		var t Tmpl
-		rem, err := ReadMeta(f, &t.Meta)
-		if err != nil {
-			return fmt.Errorf("failed to read meta from %q: %v", path, err)
+		tmpls[path] = t
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return tmpls, errs
+}
+
+func readTmpl(root, path string, funcs template.FuncMap) (Tmpl, error) {
+	f, err := os.Open(filepath.Join(root, path))
+	if err != nil {
+		return Tmpl{}, fmt.Errorf("failed to open %q: %v", path, err)
+	}
+	defer f.Close()
+
+	var meta map[string]interface{}
+	rem, err := ReadMeta(f, &meta)
+	if err != nil {
+		return Tmpl{}, fmt.Errorf("failed to read meta from %q: %v", path, err)
+	}
+
+	var buf strings.Builder
+	_, err = io.Copy(&buf, rem)
+	if err != nil {
+		return Tmpl{}, fmt.Errorf("failed to read %q: %v\n", path, err)
+	}
+
+	schema, err := ParseSchema(meta["schema"])
+	if err != nil {
+		return Tmpl{}, fmt.Errorf("invalid schema in %q: %v", path, err)
+	}
+
+	t, err := parseTmpl(path, buf.String(), meta, isHTML(path, meta), funcs)
+	t.Schema = schema
+	return t, err
+}
+
+var defaults = map[string]interface{}{
+	"sourceName": `{{.Title | slug}}.md`,
+	"buildPath":  `{{.Title | slug}}/index.{{.Type | ext}}`,
+	"pages":      PagesInfo{Per: 5},
+	"feed":       FeedInfo{Limit: 20, Format: "atom"},
+}
+
+// TmplGet looks up the special metadata field name in each of meta
+// in turn, returning the default value for the field if none of them
+// contain it.
+func TmplGet(name string, meta ...map[string]interface{}) interface{} {
+	for _, meta := range meta {
+		v, ok := meta[name]
+		if ok {
+			if fr, ok := defaults[name].(fromRawer); ok {
+				return fr.fromRaw(v)
+			}
+			return v
 		}
+	}
 
-		var buf strings.Builder
-		_, err = io.Copy(&buf, rem)
-		if err != nil {
-			return fmt.Errorf("failed to read %q: %v\n", path, err)
+	return defaults[name]
+}
+
+// MetaTmpl executes src, such as a sourceName or a buildPath, as a
+// template using data.
+func MetaTmpl(src string, data interface{}) (string, error) {
+	snt, err := template.New(src).Funcs(SiteFuncs(nil)).Parse(src)
+	if err != nil {
+		return "", err
+	}
+
+	var r strings.Builder
+	err = snt.Execute(&r, data)
+	return r.String(), err
+}
+
+type fromRawer interface {
+	fromRaw(raw interface{}) interface{}
+}
+
+// PagesInfo is the parsed form of the pages metadata field.
+type PagesInfo struct {
+	Tmpl string `yaml:"tmpl"`
+	Per  int    `yaml:"per"`
+}
+
+func (info PagesInfo) fromRaw(raw interface{}) interface{} {
+	rawmap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if tmpl, ok := rawmap["tmpl"].(string); ok {
+		info.Tmpl = tmpl
+	}
+	if per, ok := rawmap["per"].(int); ok {
+		info.Per = per
+	}
+
+	return info
+}
+
+// NumPages returns the number of pages needed to show num items per
+// to a page.
+func (info PagesInfo) NumPages(num int) int {
+	if info.Tmpl == "" {
+		return 1
+	}
+
+	var extra int
+	if num%info.Per != 0 {
+		extra = 1
+	}
+
+	return (num / info.Per) + extra
+}
+
+// PageMap returns the value of the Pages field in template data for
+// the given page of num items.
+func (info PagesInfo) PageMap(current, num int) map[string]interface{} {
+	pageEnd := current * info.Per
+	if pageEnd > num {
+		pageEnd = num
+	}
+
+	return map[string]interface{}{
+		"Last":      info.NumPages(num),
+		"Current":   current,
+		"PageStart": (current - 1) * info.Per,
+		"PageEnd":   pageEnd,
+	}
+}
+
+// Calls finds the names of the templates and types passed to the
+// tmpl and getByType functions in trees. If either is called with
+// anything other than a literal string, such as a variable, "*" is
+// returned in its place, as it's impossible to know what the actual
+// argument will be.
+func Calls(trees ...*parse.Tree) (tmpls, types []string) {
+	walkTrees(trees, func(node parse.Node) {
+		cmd, ok := node.(*parse.CommandNode)
+		if !ok {
+			return
 		}
 
-		t.Tmpl = template.New(path)
-		t.Tmpl.Funcs(StandardFuncs(tmpls))
+		ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+		if !ok {
+			return
+		}
 
-		t.Tmpl, err = t.Tmpl.Parse(buf.String())
-		if err != nil {
-			return fmt.Errorf("failed to parse %q: %v", path, err)
+		var dst *[]string
+		switch ident.Ident {
+		case "tmpl":
+			dst = &tmpls
+		case "getByType":
+			dst = &types
 		}
 
-		tmpls[path] = t
-		return nil
+		if dst != nil {
+			name := "*"
+			if len(cmd.Args) > 1 {
+				if str, ok := cmd.Args[1].(*parse.StringNode); ok {
+					name = str.Text
+				}
+			}
+			*dst = append(*dst, name)
+		}
+	})
+
+	return tmpls, types
+}
+
+// usesData returns true if anything in trees refers to a field named
+// Data, such as .Data or $.Data.
+func usesData(trees ...*parse.Tree) (data bool) {
+	walkTrees(trees, func(node parse.Node) {
+		var idents []string
+		switch node := node.(type) {
+		case *parse.FieldNode:
+			idents = node.Ident
+		case *parse.VariableNode:
+			idents = node.Ident
+		case *parse.ChainNode:
+			idents = node.Field
+		}
+
+		for _, ident := range idents {
+			if ident == "Data" {
+				data = true
+			}
+		}
 	})
-	return tmpls, err
+
+	return data
+}
+
+// walkTrees calls f for every node in trees.
+func walkTrees(trees []*parse.Tree, f func(parse.Node)) {
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		f(node)
+
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, n := range node.Nodes {
+				walk(n)
+			}
+
+		case *parse.ActionNode:
+			walk(node.Pipe)
+		case *parse.IfNode:
+			walk(&node.BranchNode)
+		case *parse.RangeNode:
+			walk(&node.BranchNode)
+		case *parse.WithNode:
+			walk(&node.BranchNode)
+		case *parse.BranchNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.TemplateNode:
+			walk(node.Pipe)
+		case *parse.ChainNode:
+			walk(node.Node)
+
+		case *parse.PipeNode:
+			if node == nil {
+				return
+			}
+			for _, cmd := range node.Cmds {
+				walk(cmd)
+			}
+
+		case *parse.CommandNode:
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+		}
+	}
+
+	for _, tree := range trees {
+		if tree != nil {
+			walk(tree.Root)
+		}
+	}
 }
@@ -0,0 +1,139 @@
+package shigoto
+
+import (
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		out  string
+		err  bool
+	}{
+		{
+			name: "String",
+			data: "*a*",
+			out:  "<p><em>a</em></p>\n",
+		},
+		{
+			name: "HTML",
+			data: htmltemplate.HTML("&lt;b&gt; &#43; &#34;c&#34;"),
+			out:  "<p>&lt;b&gt; &plus; &ldquo;c&rdquo;</p>\n",
+		},
+		{
+			name: "Map",
+			data: map[string]interface{}{"x": "b"},
+			err:  true,
+		},
+		{
+			name: "Missing",
+			data: nil,
+			err:  true,
+		},
+		{
+			name: "Int",
+			data: 3,
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := parseTmpl(test.name, `{{markdown .}}`, nil, true, SiteFuncs(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out strings.Builder
+			err = tmpl.Tmpl.Execute(&out, test.data)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if out.String() != test.out {
+				t.Errorf("expected %q, got %q", test.out, out.String())
+			}
+		})
+	}
+}
+
+func TestRenderEscapesBody(t *testing.T) {
+	site := new(Site)
+	post, err := parseTmpl("post.html", `<article>{{.Content | markdown}}</article>`, nil, true, SiteFuncs(site))
+	if err != nil {
+		t.Fatal(err)
+	}
+	site.Tmpl = map[string]Tmpl{"post.html": post}
+
+	out, err := site.Render(Content{
+		Path:  "post.md",
+		Type:  "post.html",
+		Title: "Fish & Chips",
+		Meta:  map[string]interface{}{"author": "<script>alert('1 + 1')</script>"},
+		Body:  "# {{.Title}}\n\nBy {{.Meta.author}}.\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out, "<script>") {
+		t.Errorf("metadata was not escaped: %q", out)
+	}
+	if strings.Contains(out, "&amp;lt;") || strings.Contains(out, "&amp;#") {
+		t.Errorf("metadata was escaped twice: %q", out)
+	}
+	if !strings.Contains(out, "&lt;script&gt;") || !strings.Contains(out, "Fish &amp; Chips") {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestLoadTmpl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shigoto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"page.html": `<p>{{tmpl "name.txt" .}}</p>`,
+		"name.txt":  `{{.}}`,
+		"list.html": `{{getByType "page.html"}}`,
+	}
+	for name, src := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpls, err := LoadTmpl(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	err = tmpls["page.html"].Tmpl.Execute(&out, "a & b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "<p>a &amp; b</p>" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	err = tmpls["list.html"].Tmpl.Execute(&out, nil)
+	if err == nil {
+		t.Error("expected getByType to fail")
+	}
+}